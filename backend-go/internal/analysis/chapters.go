@@ -0,0 +1,66 @@
+package analysis
+
+import (
+	"math"
+	"sort"
+	"unicode"
+
+	"japanese-learning-app/internal/models"
+)
+
+// ReadingCharsPerMinute is the reading speed used to estimate reading time.
+// It is a typical pace for an intermediate learner; native readers manage
+// roughly twice as much.
+const ReadingCharsPerMinute = 250
+
+// ChapterProfiles computes a profile for every chapter. words must be in text
+// order, as returned by the tokenizer.
+func ChapterProfiles(text []rune, chapters []models.Chapter, words []WordToken, hasJLPT bool) []models.ChapterProfile {
+	profiles := make([]models.ChapterProfile, len(chapters))
+	seen := make(map[uint]bool)
+
+	for i, chapter := range chapters {
+		from := sort.Search(len(words), func(i int) bool { return words[i].Start >= chapter.StartPos })
+		to := from
+		for to < len(words) && words[to].End <= chapter.EndPos {
+			to++
+		}
+		chapterWords := words[from:to]
+
+		unique := make(map[uint]bool)
+		newWords := 0
+		for _, w := range chapterWords {
+			if unique[w.WordID] {
+				continue
+			}
+			unique[w.WordID] = true
+			if !seen[w.WordID] {
+				newWords++
+			}
+		}
+		for id := range unique {
+			seen[id] = true
+		}
+
+		chapterText := text[chapter.StartPos:chapter.EndPos]
+		chars := 0
+		for _, r := range chapterText {
+			if !unicode.IsSpace(r) {
+				chars++
+			}
+		}
+
+		difficulty := EstimateDifficulty(chapterText, chapterWords, hasJLPT)
+		profiles[i] = models.ChapterProfile{
+			WordCount:               len(chapterWords),
+			UniqueWords:             len(unique),
+			NewWords:                newWords,
+			KanjiDensity:            difficulty.KanjiDensity,
+			CharacterCount:          chars,
+			EstimatedReadingMinutes: math.Round(float64(chars)/ReadingCharsPerMinute*10) / 10,
+			DifficultyScore:         difficulty.Score,
+			DifficultyLevel:         difficulty.Level,
+		}
+	}
+	return profiles
+}
@@ -0,0 +1,194 @@
+package analysis
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"unicode"
+
+	"japanese-learning-app/internal/models"
+	"japanese-learning-app/internal/textproc"
+	"japanese-learning-app/internal/tokenizer"
+)
+
+// WordToken is a word token together with the dictionary data needed to
+// grade it
+type WordToken struct {
+	tokenizer.Token
+	WordID        uint
+	JLPTLevel     *int
+	FrequencyRank *int
+}
+
+// Signal weights for the overall score. Signals without data are dropped and
+// the remaining weights rescaled.
+var weights = map[string]float64{
+	"jlpt":            0.30,
+	"frequency":       0.20,
+	"kanji_density":   0.20,
+	"sentence_length": 0.15,
+	"unique_words":    0.15,
+}
+
+// Level boundaries on the 0-100 score
+const (
+	intermediateFrom = 35
+	advancedFrom     = 65
+)
+
+// mattrWindow is the window size for the moving-average type/token ratio,
+// which unlike a plain ratio does not fall as texts get longer
+const mattrWindow = 500
+
+// EstimateDifficulty grades a text from its word tokens. hasJLPT tells whether
+// JLPT data was available at all, so that a missing level can be read as
+// "beyond N1" rather than "unknown".
+func EstimateDifficulty(text []rune, words []WordToken, hasJLPT bool) *models.DifficultyProfile {
+	profile := &models.DifficultyProfile{
+		SubScores: make(map[string]float64),
+	}
+
+	profile.KanjiDensity = kanjiDensity(text)
+	profile.SubScores["kanji_density"] = scale(profile.KanjiDensity, 0.10, 0.35)
+
+	profile.AverageSentenceLength = averageSentenceLength(text)
+	if profile.AverageSentenceLength > 0 {
+		profile.SubScores["sentence_length"] = scale(profile.AverageSentenceLength, 15, 50)
+	}
+
+	if len(words) > 0 {
+		profile.UniqueWordRatio = uniqueWordRatio(words)
+		profile.SubScores["unique_words"] = scale(profile.UniqueWordRatio, 0.35, 0.65)
+	}
+
+	if hasJLPT && len(words) > 0 {
+		profile.JLPTBeyond = jlptBeyond(words)
+		// N3 is roughly where native material starts; weigh the share of
+		// words past it most, with N1 and N5 shares refining the picture
+		jlpt := 0.5*scale(profile.JLPTBeyond["n3"], 0.05, 0.35) +
+			0.25*scale(profile.JLPTBeyond["n1"], 0.02, 0.20) +
+			0.25*scale(profile.JLPTBeyond["n5"], 0.20, 0.60)
+		profile.SubScores["jlpt"] = jlpt
+	}
+
+	if median := medianFrequencyRank(words); median != nil {
+		profile.MedianFrequencyRank = median
+		profile.SubScores["frequency"] = scale(math.Log10(float64(*median)), math.Log10(300), math.Log10(5000))
+	}
+
+	var total, weightSum float64
+	for name, score := range profile.SubScores {
+		total += weights[name] * score
+		weightSum += weights[name]
+	}
+	if weightSum > 0 {
+		profile.Score = math.Round(total/weightSum*1000) / 10
+	}
+	profile.Level = Level(profile.Score)
+	return profile
+}
+
+// Level maps a 0-100 difficulty score to a Book.DifficultyLevel value
+func Level(score float64) string {
+	switch {
+	case score >= advancedFrom:
+		return models.DifficultyAdvanced
+	case score >= intermediateFrom:
+		return models.DifficultyIntermediate
+	}
+	return models.DifficultyBeginner
+}
+
+// scale maps v linearly from [easy, hard] onto [0, 1], clamping outside
+func scale(v, easy, hard float64) float64 {
+	return math.Max(0, math.Min(1, (v-easy)/(hard-easy)))
+}
+
+// kanjiDensity is the share of non-space characters that are kanji
+func kanjiDensity(text []rune) float64 {
+	var kanji, chars int
+	for _, r := range text {
+		if unicode.IsSpace(r) {
+			continue
+		}
+		chars++
+		if textproc.IsKanji(r) {
+			kanji++
+		}
+	}
+	if chars == 0 {
+		return 0
+	}
+	return float64(kanji) / float64(chars)
+}
+
+// averageSentenceLength is the mean sentence length in non-space characters
+func averageSentenceLength(text []rune) float64 {
+	sentences := textproc.SplitSentences(text)
+	if len(sentences) == 0 {
+		return 0
+	}
+	chars := 0
+	for _, s := range sentences {
+		for _, r := range text[s.Start:s.End] {
+			if !unicode.IsSpace(r) {
+				chars++
+			}
+		}
+	}
+	return float64(chars) / float64(len(sentences))
+}
+
+// uniqueWordRatio is the moving-average type/token ratio over the words
+func uniqueWordRatio(words []WordToken) float64 {
+	window := min(mattrWindow, len(words))
+	counts := make(map[string]int)
+	key := func(w WordToken) string { return w.BaseForm + "\t" + w.BaseReading }
+
+	for _, w := range words[:window] {
+		counts[key(w)]++
+	}
+	sum := float64(len(counts)) / float64(window)
+	windows := 1
+	for i := window; i < len(words); i++ {
+		out := key(words[i-window])
+		if counts[out]--; counts[out] == 0 {
+			delete(counts, out)
+		}
+		counts[key(words[i])]++
+		sum += float64(len(counts)) / float64(window)
+		windows++
+	}
+	return sum / float64(windows)
+}
+
+// jlptBeyond computes the share of tokens harder than each JLPT level
+func jlptBeyond(words []WordToken) map[string]float64 {
+	beyond := make(map[string]float64, 5)
+	for level := 5; level >= 1; level-- {
+		count := 0
+		for _, w := range words {
+			if w.JLPTLevel == nil || *w.JLPTLevel < level {
+				count++
+			}
+		}
+		beyond[fmt.Sprintf("n%d", level)] = float64(count) / float64(len(words))
+	}
+	return beyond
+}
+
+// medianFrequencyRank returns the median rank over tokens with a known rank
+func medianFrequencyRank(words []WordToken) *int {
+	var ranks []int
+	for _, w := range words {
+		if w.FrequencyRank != nil {
+			ranks = append(ranks, *w.FrequencyRank)
+		}
+	}
+	if len(ranks) == 0 {
+		return nil
+	}
+	sort.Ints(ranks)
+	median := ranks[len(ranks)/2]
+	return &median
+}
@@ -0,0 +1,409 @@
+package anki
+
+import (
+	"archive/zip"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"modernc.org/sqlite"
+)
+
+// Collection files in a package, newest format first. Packages from recent
+// Anki versions also hold a collection.anki2 that only asks to update Anki.
+var collectionFiles = []string{"collection.anki21b", "collection.anki21", "collection.anki2"}
+
+// maxCollectionSize bounds an unpacked collection
+const maxCollectionSize = 2 << 30
+
+// ErrNoCollection is returned for a package without a collection in it
+var ErrNoCollection = errors.New("no Anki collection found in the package")
+
+func init() {
+	// Schema 18 collections sort names with Anki's own collation
+	sqlite.MustRegisterCollationUtf8("unicase", func(a, b string) int {
+		return strings.Compare(strings.ToLower(a), strings.ToLower(b))
+	})
+}
+
+// Collection is an Anki collection unpacked from a package
+type Collection struct {
+	db      *sql.DB
+	dir     string
+	schema  int
+	Created time.Time // Day numbers of review due dates count from here
+}
+
+// NoteType is an Anki note type, with its fields and card templates in order
+type NoteType struct {
+	ID        int64    `json:"id"`
+	Name      string   `json:"name"`
+	Fields    []string `json:"fields"`
+	Templates []string `json:"templates"`
+	Cloze     bool     `json:"cloze"`
+}
+
+// Deck is an Anki deck. Levels of nested decks are joined with "::".
+type Deck struct {
+	ID       int64
+	Name     string
+	Filtered bool
+}
+
+// Note is one Anki note
+type Note struct {
+	ID     int64
+	TypeID int64
+	Fields []string
+}
+
+// Card is one Anki card. Due is a position for new cards, a Unix time for
+// cards in learning and a day number for the rest. A card in a filtered
+// deck keeps its home deck and due in OriginalDeckID and OriginalDue.
+type Card struct {
+	ID             int64
+	NoteID         int64
+	DeckID         int64
+	Ord            int
+	Type           int // 0 new, 1 learning, 2 review, 3 relearning
+	Queue          int // -1 suspended, -2 and -3 buried
+	Due            int64
+	Interval       int // Days, or seconds if negative
+	Factor         int // Ease in permille
+	Reps           int
+	Lapses         int
+	OriginalDue    int64
+	OriginalDeckID int64
+	Data           string // JSON; holds the FSRS memory state
+}
+
+// Review is one entry of the review log
+type Review struct {
+	ID       int64 // Unix time of the review in milliseconds
+	CardID   int64
+	Ease     int // 1 again ... 4 easy, 0 for a manual reschedule
+	Interval int // Days, or seconds if negative
+	LastIvl  int
+	Factor   int
+	TimeMs   int
+	Type     int // 0 learning, 1 review, 2 relearning, 3 filtered, 4 manual
+}
+
+// Open unpacks the collection of an .apkg or .colpkg file. Close it when done.
+func Open(path string) (*Collection, error) {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, fmt.Errorf("not an Anki package: %w", err)
+	}
+	defer zr.Close()
+
+	var file *zip.File
+	for _, name := range collectionFiles {
+		for _, f := range zr.File {
+			if f.Name == name {
+				file = f
+				break
+			}
+		}
+		if file != nil {
+			break
+		}
+	}
+	if file == nil {
+		return nil, ErrNoCollection
+	}
+
+	dir, err := os.MkdirTemp("", "anki-import-")
+	if err != nil {
+		return nil, err
+	}
+	col := &Collection{dir: dir}
+	if err := col.unpack(file); err != nil {
+		col.Close()
+		return nil, err
+	}
+	if err := col.load(); err != nil {
+		col.Close()
+		return nil, err
+	}
+	return col, nil
+}
+
+// unpack writes the collection database to the temporary directory
+func (c *Collection) unpack(file *zip.File) error {
+	rc, err := file.Open()
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", file.Name, err)
+	}
+	defer rc.Close()
+
+	var r io.Reader = rc
+	if strings.HasSuffix(file.Name, ".anki21b") {
+		dec, err := zstd.NewReader(rc)
+		if err != nil {
+			return fmt.Errorf("failed to decompress %s: %w", file.Name, err)
+		}
+		defer dec.Close()
+		r = dec
+	}
+
+	path := filepath.Join(c.dir, "collection.db")
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(out, io.LimitReader(r, maxCollectionSize+1))
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to unpack %s: %w", file.Name, err)
+	}
+	if n > maxCollectionSize {
+		return fmt.Errorf("collection is larger than %d GB", maxCollectionSize>>30)
+	}
+
+	c.db, err = sql.Open("sqlite", "file:"+path+"?mode=ro")
+	return err
+}
+
+// load reads the collection's creation time and schema version
+func (c *Collection) load() error {
+	var crt int64
+	if err := c.db.QueryRow("SELECT crt, ver FROM col").Scan(&crt, &c.schema); err != nil {
+		return fmt.Errorf("not an Anki collection: %w", err)
+	}
+	c.Created = time.Unix(crt, 0)
+	return nil
+}
+
+// Close removes the unpacked collection
+func (c *Collection) Close() error {
+	if c.db != nil {
+		c.db.Close()
+	}
+	return os.RemoveAll(c.dir)
+}
+
+// legacy reports whether note types and decks are kept as JSON in the col
+// table, as before schema 15
+func (c *Collection) legacy() bool {
+	return c.schema < 15
+}
+
+// NoteTypes returns the collection's note types by ID
+func (c *Collection) NoteTypes() (map[int64]*NoteType, error) {
+	types := make(map[int64]*NoteType)
+	if c.legacy() {
+		var raw string
+		if err := c.db.QueryRow("SELECT models FROM col").Scan(&raw); err != nil {
+			return nil, fmt.Errorf("failed to read note types: %w", err)
+		}
+		var models map[string]struct {
+			ID    json.Number `json:"id"`
+			Name  string      `json:"name"`
+			Type  int         `json:"type"`
+			Flds  []legacyOrd `json:"flds"`
+			Tmpls []legacyOrd `json:"tmpls"`
+		}
+		if err := json.Unmarshal([]byte(raw), &models); err != nil {
+			return nil, fmt.Errorf("failed to read note types: %w", err)
+		}
+		for _, m := range models {
+			id, err := m.ID.Int64()
+			if err != nil {
+				return nil, fmt.Errorf("failed to read note types: %w", err)
+			}
+			types[id] = &NoteType{
+				ID:        id,
+				Name:      m.Name,
+				Fields:    byOrd(m.Flds),
+				Templates: byOrd(m.Tmpls),
+				Cloze:     m.Type == 1,
+			}
+		}
+		return types, nil
+	}
+
+	rows, err := c.db.Query("SELECT id, name, config FROM notetypes")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read note types: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var t NoteType
+		var config []byte
+		if err := rows.Scan(&t.ID, &t.Name, &config); err != nil {
+			return nil, fmt.Errorf("failed to read note types: %w", err)
+		}
+		t.Cloze = clozeKind(config)
+		types[t.ID] = &t
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read note types: %w", err)
+	}
+	for table, field := range map[string]func(t *NoteType) *[]string{
+		"fields":    func(t *NoteType) *[]string { return &t.Fields },
+		"templates": func(t *NoteType) *[]string { return &t.Templates },
+	} {
+		rows, err := c.db.Query("SELECT ntid, name FROM " + table + " ORDER BY ntid, ord")
+		if err != nil {
+			return nil, fmt.Errorf("failed to read note %s: %w", table, err)
+		}
+		for rows.Next() {
+			var id int64
+			var name string
+			if err := rows.Scan(&id, &name); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("failed to read note %s: %w", table, err)
+			}
+			if t := types[id]; t != nil {
+				names := field(t)
+				*names = append(*names, name)
+			}
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read note %s: %w", table, err)
+		}
+	}
+	return types, nil
+}
+
+// Decks returns the collection's decks by ID
+func (c *Collection) Decks() (map[int64]Deck, error) {
+	decks := make(map[int64]Deck)
+	if c.legacy() {
+		var raw string
+		if err := c.db.QueryRow("SELECT decks FROM col").Scan(&raw); err != nil {
+			return nil, fmt.Errorf("failed to read decks: %w", err)
+		}
+		var all map[string]struct {
+			ID   json.Number `json:"id"`
+			Name string      `json:"name"`
+			Dyn  int         `json:"dyn"`
+		}
+		if err := json.Unmarshal([]byte(raw), &all); err != nil {
+			return nil, fmt.Errorf("failed to read decks: %w", err)
+		}
+		for _, d := range all {
+			id, err := d.ID.Int64()
+			if err != nil {
+				return nil, fmt.Errorf("failed to read decks: %w", err)
+			}
+			decks[id] = Deck{ID: id, Name: d.Name, Filtered: d.Dyn != 0}
+		}
+		return decks, nil
+	}
+
+	rows, err := c.db.Query("SELECT id, name, kind FROM decks")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read decks: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var d Deck
+		var kind []byte
+		if err := rows.Scan(&d.ID, &d.Name, &kind); err != nil {
+			return nil, fmt.Errorf("failed to read decks: %w", err)
+		}
+		// Levels are separated by 0x1f; kind is a protobuf oneof whose
+		// field 2 marks a filtered deck
+		d.Name = strings.ReplaceAll(d.Name, "\x1f", "::")
+		d.Filtered = len(kind) > 0 && kind[0]>>3 == 2
+		decks[d.ID] = d
+	}
+	return decks, rows.Err()
+}
+
+// Notes returns every note
+func (c *Collection) Notes() ([]Note, error) {
+	rows, err := c.db.Query("SELECT id, mid, flds FROM notes ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read notes: %w", err)
+	}
+	defer rows.Close()
+	var notes []Note
+	for rows.Next() {
+		var n Note
+		var fields string
+		if err := rows.Scan(&n.ID, &n.TypeID, &fields); err != nil {
+			return nil, fmt.Errorf("failed to read notes: %w", err)
+		}
+		n.Fields = strings.Split(fields, "\x1f")
+		notes = append(notes, n)
+	}
+	return notes, rows.Err()
+}
+
+// Cards returns every card, new cards in the order they would be studied
+func (c *Collection) Cards() ([]Card, error) {
+	rows, err := c.db.Query(`SELECT id, nid, did, ord, type, queue, due, ivl, factor, reps, lapses, odue, odid, data
+		FROM cards ORDER BY type, due, id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cards: %w", err)
+	}
+	defer rows.Close()
+	var cards []Card
+	for rows.Next() {
+		var card Card
+		var data sql.NullString
+		err := rows.Scan(&card.ID, &card.NoteID, &card.DeckID, &card.Ord, &card.Type, &card.Queue, &card.Due,
+			&card.Interval, &card.Factor, &card.Reps, &card.Lapses, &card.OriginalDue, &card.OriginalDeckID, &data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read cards: %w", err)
+		}
+		card.Data = data.String
+		cards = append(cards, card)
+	}
+	return cards, rows.Err()
+}
+
+// Reviews returns the review log, each card's reviews in order
+func (c *Collection) Reviews() ([]Review, error) {
+	rows, err := c.db.Query(`SELECT id, cid, ease, ivl, lastIvl, factor, time, type FROM revlog ORDER BY cid, id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read review log: %w", err)
+	}
+	defer rows.Close()
+	var reviews []Review
+	for rows.Next() {
+		var r Review
+		if err := rows.Scan(&r.ID, &r.CardID, &r.Ease, &r.Interval, &r.LastIvl, &r.Factor, &r.TimeMs, &r.Type); err != nil {
+			return nil, fmt.Errorf("failed to read review log: %w", err)
+		}
+		reviews = append(reviews, r)
+	}
+	return reviews, rows.Err()
+}
+
+// legacyOrd is a field or template of a legacy note type
+type legacyOrd struct {
+	Name string `json:"name"`
+	Ord  int    `json:"ord"`
+}
+
+// byOrd lists the names in ord order
+func byOrd(items []legacyOrd) []string {
+	names := make([]string, len(items))
+	for _, item := range items {
+		if item.Ord >= 0 && item.Ord < len(names) {
+			names[item.Ord] = item.Name
+		}
+	}
+	return names
+}
+
+// clozeKind reports whether a schema 18 note type config marks a cloze
+// type: its field 1, the kind, is 1 for cloze
+func clozeKind(config []byte) bool {
+	return len(config) >= 2 && config[0] == 0x08 && config[1] == 0x01
+}
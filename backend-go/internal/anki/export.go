@@ -0,0 +1,523 @@
+package anki
+
+import (
+	"archive/zip"
+	"crypto/sha1"
+	"database/sql"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"japanese-learning-app/internal/models"
+	"japanese-learning-app/internal/srs"
+)
+
+// ExportNoteType is the name of the note type exported cards get
+const ExportNoteType = "Japanese Vocabulary"
+
+// ExportFields are the fields of the exported note type, in order. Anki
+// takes the first as the note's key and rejects notes where it is empty,
+// so it is the word.
+var ExportFields = []string{"Word", "Reading", "Definition", "Sentence", "Source", "Audio"}
+
+// exportTemplate is a template of the exported note type and the card type
+// it shows
+type exportTemplate struct {
+	name, cardType string
+	front, back    string
+	required       int // Field that must not be empty
+}
+
+// Templates of the exported note type; a card's ord is its index here
+var exportTemplates = []exportTemplate{
+	{"Recognition", models.CardTypeRecognition,
+		`<div class="word">{{Word}}</div>{{#Audio}}{{Audio}}{{/Audio}}`,
+		`{{FrontSide}}<hr id="answer"><div class="reading">{{Reading}}</div><div>{{Definition}}</div>{{#Sentence}}<div class="sentence">{{Sentence}}</div>{{/Sentence}}{{#Source}}<div class="source">{{Source}}</div>{{/Source}}`,
+		0},
+	{"Recall", models.CardTypeRecall,
+		`<div>{{Definition}}</div>`,
+		`{{FrontSide}}<hr id="answer"><div class="word">{{Word}}</div><div class="reading">{{Reading}}</div>{{Audio}}{{#Sentence}}<div class="sentence">{{Sentence}}</div>{{/Sentence}}`,
+		2},
+	{"Production", models.CardTypeProduction,
+		`<div>{{Definition}}</div><div class="reading">{{Reading}}</div>`,
+		`{{FrontSide}}<hr id="answer"><div class="word">{{Word}}</div>{{Audio}}{{#Sentence}}<div class="sentence">{{Sentence}}</div>{{/Sentence}}`,
+		2},
+	{"Sentence", models.CardTypeSentence,
+		`<div class="sentence">{{Sentence}}</div>`,
+		`{{FrontSide}}<hr id="answer"><div class="word">{{Word}}</div><div class="reading">{{Reading}}</div><div>{{Definition}}</div>{{Audio}}{{#Source}}<div class="source">{{Source}}</div>{{/Source}}`,
+		3},
+}
+
+const exportCSS = `.card { font-family: sans-serif; font-size: 20px; text-align: center; }
+.word { font-size: 40px; }
+.reading { color: #666; }
+.sentence { margin-top: 1em; }
+.sentence b { color: #c33; }
+.source { margin-top: 1em; font-size: 14px; color: #999; }`
+
+// ExportNote is a word with its cards, the fields of an exported note. Text
+// fields are HTML.
+type ExportNote struct {
+	WordID     uint
+	Sentence   string
+	Word       string
+	Reading    string
+	Definition string
+	Source     string
+	Audio      string // A file to pack as media, or a URL
+	Cards      []ExportCard
+}
+
+// ExportCard is a card of an exported note
+type ExportCard struct {
+	Card    *models.SRSCard
+	Deck    string                 // Name of its home deck
+	Reviews []models.ReviewHistory // Optional
+}
+
+// ExportOptions set up an export
+type ExportOptions struct {
+	Study          srs.StudySettings
+	Leech          srs.LeechSettings
+	IncludeHistory bool
+	MediaDir       string // Where Audio file names are looked up
+	MediaPrefix    string // Only files whose names start with it are packed
+}
+
+// exportSchema creates an Anki 2.1 collection, schema 11, which every
+// version of Anki since 2.1 imports
+const exportSchema = `
+CREATE TABLE col (id integer primary key, crt integer not null, mod integer not null, scm integer not null,
+	ver integer not null, dty integer not null, usn integer not null, ls integer not null, conf text not null,
+	models text not null, decks text not null, dconf text not null, tags text not null);
+CREATE TABLE notes (id integer primary key, guid text not null, mid integer not null, mod integer not null,
+	usn integer not null, tags text not null, flds text not null, sfld integer not null, csum integer not null,
+	flags integer not null, data text not null);
+CREATE TABLE cards (id integer primary key, nid integer not null, did integer not null, ord integer not null,
+	mod integer not null, usn integer not null, type integer not null, queue integer not null, due integer not null,
+	ivl integer not null, factor integer not null, reps integer not null, lapses integer not null, left integer not null,
+	odue integer not null, odid integer not null, flags integer not null, data text not null);
+CREATE TABLE revlog (id integer primary key, cid integer not null, usn integer not null, ease integer not null,
+	ivl integer not null, lastIvl integer not null, factor integer not null, time integer not null, type integer not null);
+CREATE TABLE graves (usn integer not null, oid integer not null, type integer not null);
+CREATE INDEX ix_notes_usn ON notes (usn);
+CREATE INDEX ix_cards_usn ON cards (usn);
+CREATE INDEX ix_revlog_usn ON revlog (usn);
+CREATE INDEX ix_cards_nid ON cards (nid);
+CREATE INDEX ix_cards_sched ON cards (did, queue, due);
+CREATE INDEX ix_revlog_cid ON revlog (cid);
+CREATE INDEX ix_notes_csum ON notes (csum);`
+
+// Export writes the notes as an .apkg package to w
+func Export(w io.Writer, notes []ExportNote, opts ExportOptions, now time.Time) error {
+	dir, err := os.MkdirTemp("", "anki-export-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "collection.anki2")
+
+	e := &exporter{opts: opts, now: now, nextID: now.UnixMilli(), decks: map[string]int64{}, reviewIDs: map[int64]bool{}}
+	media, err := e.write(path, notes)
+	if err != nil {
+		return err
+	}
+
+	zw := zip.NewWriter(w)
+	if err := addFile(zw, "collection.anki2", path); err != nil {
+		return err
+	}
+	index := make(map[string]string, len(media))
+	for i, file := range media {
+		name := fmt.Sprint(i)
+		index[name] = filepath.Base(file)
+		if err := addFile(zw, name, file); err != nil {
+			return err
+		}
+	}
+	mw, err := zw.Create("media")
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(mw).Encode(index); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// addFile copies a file into the package
+func addFile(zw *zip.Writer, name, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// exporter holds the state of one export
+type exporter struct {
+	opts   ExportOptions
+	now    time.Time
+	crt    time.Time
+	nextID int64
+	decks  map[string]int64 // By name
+
+	reviewIDs map[int64]bool
+}
+
+// id hands out the next unused ID, Anki IDs being times in milliseconds
+func (e *exporter) id() int64 {
+	e.nextID++
+	return e.nextID
+}
+
+// write creates the collection and returns the media files it refers to
+func (e *exporter) write(path string, notes []ExportNote) ([]string, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(exportSchema); err != nil {
+		return nil, fmt.Errorf("failed to create collection: %w", err)
+	}
+
+	// Day numbers of review cards count from the first day any card is due
+	e.crt = e.opts.Study.DayStart(e.now)
+	for _, n := range notes {
+		for _, c := range n.Cards {
+			if c.Card.State != models.CardStateNew {
+				if start := e.opts.Study.DayStart(c.Card.DueDate); start.Before(e.crt) {
+					e.crt = start
+				}
+			}
+		}
+	}
+
+	modelID := e.id()
+	var media []string
+	seen := make(map[string]bool)
+	newPos := 0
+	mod := e.now.Unix()
+	for _, n := range notes {
+		audio := n.Audio
+		if file := e.mediaFile(audio); file != "" {
+			if !seen[file] {
+				seen[file] = true
+				media = append(media, file)
+			}
+			audio = "[sound:" + filepath.Base(file) + "]"
+		} else if isURL(audio) {
+			audio = `<a href="` + html.EscapeString(audio) + `">` + html.EscapeString(audio) + `</a>`
+		} else {
+			audio = ""
+		}
+
+		fields := []string{n.Word, n.Reading, n.Definition, n.Sentence, n.Source, audio}
+		var tags []string
+		for _, c := range n.Cards {
+			if c.Card.IsLeech && !slices.Contains(tags, "leech") {
+				tags = append(tags, "leech")
+			}
+		}
+		tagText := ""
+		if len(tags) > 0 {
+			tagText = " " + strings.Join(tags, " ") + " "
+		}
+
+		noteID := e.id()
+		_, err := tx.Exec(`INSERT INTO notes VALUES (?, ?, ?, ?, -1, ?, ?, ?, ?, 0, '')`,
+			noteID, guid(n.WordID), modelID, mod, tagText, strings.Join(fields, "\x1f"), plainText(fields[0]), checksum(fields[0]))
+		if err != nil {
+			return nil, fmt.Errorf("failed to write note: %w", err)
+		}
+
+		for _, c := range n.Cards {
+			ord := templateOrd(c.Card.CardType)
+			if ord < 0 {
+				continue
+			}
+			cardID := e.id()
+			s := e.schedule(c.Card, newPos)
+			if c.Card.State == models.CardStateNew {
+				newPos++
+			}
+			_, err := tx.Exec(`INSERT INTO cards VALUES (?, ?, ?, ?, ?, -1, ?, ?, ?, ?, ?, ?, ?, ?, 0, 0, 0, ?)`,
+				cardID, noteID, e.deckID(c.Deck), ord, mod, s.kind, s.queue, s.due, s.interval, s.factor,
+				c.Card.TotalReviews, c.Card.Lapses, s.left, s.data)
+			if err != nil {
+				return nil, fmt.Errorf("failed to write card: %w", err)
+			}
+			if e.opts.IncludeHistory {
+				if err := e.writeReviews(tx, cardID, c.Reviews); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	if err := e.writeCol(tx, modelID, newPos); err != nil {
+		return nil, err
+	}
+	return media, tx.Commit()
+}
+
+// deckID returns the ID of the deck with the given name, adding it. Anki's
+// default deck stands in for the user's default deck.
+func (e *exporter) deckID(name string) int64 {
+	if name == "" {
+		return defaultDeckID
+	}
+	if id, ok := e.decks[name]; ok {
+		return id
+	}
+	id := e.id()
+	e.decks[name] = id
+	return id
+}
+
+// ankiSchedule is a card's scheduling in Anki's terms
+type ankiSchedule struct {
+	kind, queue int   // Card type and queue
+	due         int64 // New position, Unix time in learning or day number
+	interval    int
+	factor      int
+	left        int
+	data        string
+}
+
+// schedule converts a card's scheduling to Anki's
+func (e *exporter) schedule(card *models.SRSCard, newPos int) ankiSchedule {
+	s := ankiSchedule{data: "{}"}
+	switch card.State {
+	case models.CardStateNew:
+		s.kind, s.queue, s.due = 0, 0, int64(newPos)
+	case models.CardStateLearning:
+		s.kind, s.queue, s.due = 1, 1, card.DueDate.Unix()
+		s.left = 1001
+	case models.CardStateRelearning:
+		s.kind, s.queue, s.due = 3, 1, card.DueDate.Unix()
+		s.left = 1001
+	default:
+		s.kind, s.queue = 2, 2
+		s.due = int64(e.opts.Study.DayStart(card.DueDate).Sub(e.crt).Hours()/24 + 0.5)
+	}
+	if card.State != models.CardStateNew {
+		s.interval = max(card.IntervalDays, 1)
+		s.factor = int(card.EaseFactor*1000 + 0.5)
+	}
+	if card.Stability > 0 {
+		data, _ := json.Marshal(map[string]float64{"s": card.Stability, "d": card.Difficulty})
+		s.data = string(data)
+	}
+	switch {
+	case card.IsSuspended:
+		s.queue = -1
+	case card.IsBuried && card.BuriedUntil != nil && card.BuriedUntil.After(e.now):
+		s.queue = -3
+	}
+	return s
+}
+
+// writeReviews adds a card's review history to the review log
+func (e *exporter) writeReviews(tx *sql.Tx, cardID int64, reviews []models.ReviewHistory) error {
+	for _, r := range reviews {
+		if r.ResponseQuality < 1 || r.ResponseQuality > 4 {
+			continue
+		}
+		// The review time is the ID, so reviews in the same millisecond
+		// are spread apart
+		id := r.ReviewedAt.UnixMilli()
+		for e.reviewIDs[id] {
+			id++
+		}
+		e.reviewIDs[id] = true
+		ms := 0
+		if r.ResponseTimeMs != nil {
+			ms = min(*r.ResponseTimeMs, 60000)
+		}
+		kind := 0
+		switch r.OldState {
+		case models.CardStateReview:
+			kind = 1
+		case models.CardStateRelearning:
+			kind = 2
+		}
+		_, err := tx.Exec(`INSERT INTO revlog VALUES (?, ?, -1, ?, ?, ?, ?, ?, ?)`,
+			id, cardID, r.ResponseQuality,
+			ankiInterval(r.NewState, r.NewInterval, r.NewDueDate.Sub(r.ReviewedAt)),
+			ankiInterval(r.OldState, r.OldInterval, r.OldDueDate.Sub(r.ReviewedAt)),
+			int(r.NewEaseFactor*1000+0.5), ms, kind)
+		if err != nil {
+			return fmt.Errorf("failed to write review log: %w", err)
+		}
+	}
+	return nil
+}
+
+// ankiInterval is an interval in the review log: days, or negative seconds
+// for a learning step
+func ankiInterval(state string, days int, until time.Duration) int {
+	switch state {
+	case models.CardStateNew:
+		return 0
+	case models.CardStateReview:
+		return max(days, 1)
+	}
+	return -max(int(until.Seconds()), 1)
+}
+
+// writeCol adds the collection row holding the note type, decks and options
+func (e *exporter) writeCol(tx *sql.Tx, modelID int64, nextPos int) error {
+	mod := e.now.Unix()
+	fields := make([]map[string]interface{}, len(ExportFields))
+	for i, name := range ExportFields {
+		fields[i] = map[string]interface{}{
+			"name": name, "ord": i, "sticky": false, "rtl": false, "font": "Arial", "size": 20, "media": []string{},
+		}
+	}
+	templates := make([]map[string]interface{}, len(exportTemplates))
+	req := make([][]interface{}, len(exportTemplates))
+	for i, t := range exportTemplates {
+		templates[i] = map[string]interface{}{
+			"name": t.name, "ord": i, "qfmt": t.front, "afmt": t.back,
+			"bqfmt": "", "bafmt": "", "did": nil, "bfont": "", "bsize": 0,
+		}
+		req[i] = []interface{}{i, "any", []int{t.required}}
+	}
+	noteTypes := map[string]interface{}{
+		fmt.Sprint(modelID): map[string]interface{}{
+			"id": modelID, "name": ExportNoteType, "type": 0, "mod": mod, "usn": -1, "sortf": 0,
+			"did": defaultDeckID, "tmpls": templates, "flds": fields, "css": exportCSS,
+			"latexPre":  "\\documentclass[12pt]{article}\n\\special{papersize=3in,5in}\n\\usepackage[utf8]{inputenc}\n\\usepackage{amssymb,amsmath}\n\\pagestyle{empty}\n\\setlength{\\parindent}{0in}\n\\begin{document}\n",
+			"latexPost": "\\end{document}", "latexsvg": false, "req": req, "tags": []string{}, "vers": []string{},
+		},
+	}
+
+	deck := func(id int64, name string) map[string]interface{} {
+		return map[string]interface{}{
+			"id": id, "name": name, "mod": mod, "usn": -1, "desc": "", "dyn": 0, "conf": 1,
+			"collapsed": false, "browserCollapsed": false, "extendNew": 0, "extendRev": 0,
+			"newToday": []int{0, 0}, "revToday": []int{0, 0}, "lrnToday": []int{0, 0}, "timeToday": []int{0, 0},
+		}
+	}
+	decks := map[string]interface{}{fmt.Sprint(defaultDeckID): deck(defaultDeckID, "Default")}
+	for name, id := range e.decks {
+		decks[fmt.Sprint(id)] = deck(id, name)
+	}
+
+	leechAction := 1 // Tag only
+	if e.opts.Leech.Action == srs.LeechActionSuspend {
+		leechAction = 0
+	}
+	options := map[string]interface{}{
+		"1": map[string]interface{}{
+			"id": 1, "name": "Default", "mod": mod, "usn": -1, "maxTaken": 60, "autoplay": true, "timer": 0,
+			"replayq": true, "dyn": false,
+			"new": map[string]interface{}{
+				"delays": []float64{1, 10}, "ints": []int{1, 4, 0}, "initialFactor": 2500, "order": 1,
+				"perDay": e.opts.Study.NewCardsPerDay, "bury": true,
+			},
+			"rev": map[string]interface{}{
+				"perDay": e.opts.Study.MaxReviewsPerDay, "ease4": 1.3, "ivlFct": 1, "maxIvl": 36500,
+				"bury": true, "hardFactor": 1.2,
+			},
+			"lapse": map[string]interface{}{
+				"delays": []float64{10}, "mult": 0, "minInt": 1, "leechFails": e.opts.Leech.Threshold,
+				"leechAction": leechAction,
+			},
+		},
+	}
+	conf := map[string]interface{}{
+		"nextPos": nextPos, "estTimes": true, "activeDecks": []int{defaultDeckID}, "sortType": "noteFld",
+		"timeLim": 0, "sortBackwards": false, "addToCur": true, "curDeck": defaultDeckID, "newSpread": 0,
+		"dueCounts": true, "curModel": modelID, "collapseTime": 1200,
+	}
+
+	values := make([]interface{}, 0, 4)
+	for _, v := range []interface{}{conf, noteTypes, decks, options} {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		values = append(values, string(data))
+	}
+	_, err := tx.Exec(`INSERT INTO col VALUES (1, ?, ?, ?, 11, 0, 0, 0, ?, ?, ?, ?, '{}')`,
+		append([]interface{}{e.crt.Unix(), e.now.UnixMilli(), e.now.UnixMilli()}, values...)...)
+	if err != nil {
+		return fmt.Errorf("failed to write collection: %w", err)
+	}
+	return nil
+}
+
+// mediaFile returns the path of an Audio value naming a file in the media
+// directory with the media prefix, or "" if it names none
+func (e *exporter) mediaFile(audio string) string {
+	if audio == "" || e.opts.MediaDir == "" || isURL(audio) {
+		return ""
+	}
+	name := filepath.Base(filepath.Clean("/" + audio))
+	if !strings.HasPrefix(name, e.opts.MediaPrefix) {
+		return ""
+	}
+	path := filepath.Join(e.opts.MediaDir, name)
+	if info, err := os.Stat(path); err != nil || !info.Mode().IsRegular() {
+		return ""
+	}
+	return path
+}
+
+// isURL reports whether s is a web address
+func isURL(s string) bool {
+	return strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://")
+}
+
+// templateOrd is the template of a card type, or -1 if there is none
+func templateOrd(cardType string) int {
+	for i, t := range exportTemplates {
+		if t.cardType == cardType {
+			return i
+		}
+	}
+	return -1
+}
+
+// guid identifies a word's note, so that exporting it again updates the
+// note in Anki rather than adding another
+func guid(wordID uint) string {
+	return fmt.Sprintf("jla-word-%d", wordID)
+}
+
+// htmlTag matches an HTML tag
+var htmlTag = regexp.MustCompile(`<[^>]*>`)
+
+// plainText is the text of a field, as Anki sorts and checksums it
+func plainText(s string) string {
+	return html.UnescapeString(htmlTag.ReplaceAllString(s, ""))
+}
+
+// checksum is Anki's checksum of a note's sort field: the first 8 hex digits
+// of the SHA-1 of its text
+func checksum(s string) int64 {
+	sum := sha1.Sum([]byte(plainText(s)))
+	return int64(binary.BigEndian.Uint32(sum[:4]))
+}
@@ -0,0 +1,758 @@
+package anki
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"japanese-learning-app/internal/cards"
+	"japanese-learning-app/internal/knowledge"
+	"japanese-learning-app/internal/models"
+	"japanese-learning-app/internal/srs"
+	"japanese-learning-app/internal/textproc"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ReviewContext marks the review history brought in from Anki
+const ReviewContext = "anki_import"
+
+// batchSize bounds batched inserts and IN lists
+const batchSize = 500
+
+// MaxWordLength matches the size of words.surface_form and words.reading
+const MaxWordLength = 100
+
+// defaultDeckID is the ID of Anki's default deck
+const defaultDeckID = 1
+
+// Field names tried, in order, when a note type has no mapping
+var (
+	wordFieldNames    = []string{"Expression", "Word", "Vocab", "Vocabulary", "Kanji", "Japanese", "Front"}
+	readingFieldNames = []string{"Reading", "Kana", "Furigana", "Hiragana", "Vocab Reading", "Word Reading"}
+	meaningFieldNames = []string{"Meaning", "English", "Definition", "Glossary", "Vocab Meaning", "Word Meaning", "Back"}
+)
+
+// Mapping says which fields of a note type hold the word, its reading and
+// its meaning, and which card type each of its templates becomes
+type Mapping struct {
+	Word      string   `json:"word"`
+	Reading   string   `json:"reading,omitempty"`
+	Meaning   string   `json:"meaning,omitempty"`
+	CardTypes []string `json:"card_types"` // By template; "" leaves a template out
+	Skip      bool     `json:"skip,omitempty"`
+}
+
+// NoteTypeResult is how one note type is imported
+type NoteTypeResult struct {
+	NoteType
+	Mapping Mapping `json:"mapping"`
+	Notes   int     `json:"notes"`
+	Cards   int     `json:"cards"`
+}
+
+// Result summarizes an import
+type Result struct {
+	NoteTypes    []NoteTypeResult `json:"note_types"`
+	Notes        int              `json:"notes"`
+	NotesSkipped int              `json:"notes_skipped"` // Of skipped note types, or without a word or with one too long
+	WordsCreated int              `json:"words_created"`
+	CardsCreated int              `json:"cards_created"`
+	CardsSkipped int              `json:"cards_skipped"` // Of templates left out, or of words and types the user has cards for
+	Reviews      int              `json:"reviews"`
+	Decks        []string         `json:"decks"`
+}
+
+// DefaultMapping guesses a note type's mapping from its field names, using
+// the first field for the word if none is recognized. Templates become
+// recognition, recall and production cards in turn; a cloze type only makes
+// recognition cards.
+func DefaultMapping(t *NoteType) Mapping {
+	m := Mapping{
+		Word:    findField(t.Fields, wordFieldNames),
+		Reading: findField(t.Fields, readingFieldNames),
+		Meaning: findField(t.Fields, meaningFieldNames),
+	}
+	if m.Word == "" && len(t.Fields) > 0 {
+		m.Word = t.Fields[0]
+	}
+	if m.Meaning == m.Word {
+		m.Meaning = ""
+	}
+	if t.Cloze {
+		m.CardTypes = []string{models.CardTypeRecognition}
+		return m
+	}
+	m.CardTypes = make([]string, len(t.Templates))
+	copy(m.CardTypes, cards.TemplateTypes)
+	return m
+}
+
+// findField returns the first of the names, ignoring case, that the fields
+// have
+func findField(fields, names []string) string {
+	for _, name := range names {
+		for _, f := range fields {
+			if strings.EqualFold(strings.TrimSpace(f), name) {
+				return f
+			}
+		}
+	}
+	return ""
+}
+
+// validate checks that the mapping names fields and card types of the type
+func (m Mapping) validate(t *NoteType) error {
+	if m.Skip {
+		return nil
+	}
+	if m.Word == "" {
+		return fmt.Errorf("note type %q: a word field is required", t.Name)
+	}
+	for _, f := range []string{m.Word, m.Reading, m.Meaning} {
+		if f != "" && !slices.Contains(t.Fields, f) {
+			return fmt.Errorf("note type %q has no field %q", t.Name, f)
+		}
+	}
+	seen := make(map[string]bool)
+	for _, ct := range m.CardTypes {
+		if ct == "" {
+			continue
+		}
+		if !slices.Contains(cards.TemplateTypes, ct) {
+			return fmt.Errorf("note type %q: unknown card type %q", t.Name, ct)
+		}
+		if seen[ct] {
+			return fmt.Errorf("note type %q: card type %q is used twice", t.Name, ct)
+		}
+		seen[ct] = true
+	}
+	return nil
+}
+
+// MappingError is returned for a mapping that does not fit its note type
+type MappingError struct {
+	err error
+}
+
+func (e *MappingError) Error() string {
+	return e.err.Error()
+}
+
+// importer holds the state of one import
+type importer struct {
+	tx     *gorm.DB
+	userID uint
+	col    *Collection
+	now    time.Time
+	result *Result
+
+	types    map[int64]*NoteType
+	mappings map[int64]Mapping
+	notes    []Note
+	cards    []Card
+	noteType map[int64]int64 // By note ID
+	created  []uint          // Decks added by the import
+}
+
+// Inspect reads the collection's note types and how they would be imported
+// with the given mappings, keyed by note type name, without importing
+// anything
+func Inspect(col *Collection, mappings map[string]Mapping) (*Result, error) {
+	imp := &importer{col: col}
+	if err := imp.plan(mappings); err != nil {
+		return nil, err
+	}
+	return imp.result, nil
+}
+
+// Import adds the collection's notes to the user's words and cards, keeping
+// the scheduling of their cards, and the review log to their review history.
+// Cards of words and types the user already has are left alone, so importing
+// the same collection twice adds nothing. Run it inside a transaction.
+func Import(tx *gorm.DB, userID uint, col *Collection, mappings map[string]Mapping, now time.Time) (*Result, error) {
+	imp := &importer{tx: tx, userID: userID, col: col, now: now}
+	if err := imp.plan(mappings); err != nil {
+		return nil, err
+	}
+	if err := imp.run(); err != nil {
+		return nil, err
+	}
+	return imp.result, nil
+}
+
+// plan reads the notes and cards and settles each note type's mapping
+func (imp *importer) plan(mappings map[string]Mapping) error {
+	var err error
+	if imp.types, err = imp.col.NoteTypes(); err != nil {
+		return err
+	}
+	if imp.notes, err = imp.col.Notes(); err != nil {
+		return err
+	}
+	if imp.cards, err = imp.col.Cards(); err != nil {
+		return err
+	}
+
+	imp.mappings = make(map[int64]Mapping, len(imp.types))
+	for id, t := range imp.types {
+		m, ok := mappings[t.Name]
+		if !ok {
+			m = DefaultMapping(t)
+		}
+		if err := m.validate(t); err != nil {
+			return &MappingError{err}
+		}
+		imp.mappings[id] = m
+	}
+
+	counts := make(map[int64][2]int)
+	for _, n := range imp.notes {
+		c := counts[n.TypeID]
+		c[0]++
+		counts[n.TypeID] = c
+	}
+	imp.noteType = make(map[int64]int64, len(imp.notes))
+	for _, n := range imp.notes {
+		imp.noteType[n.ID] = n.TypeID
+	}
+	for _, card := range imp.cards {
+		id := imp.noteType[card.NoteID]
+		c := counts[id]
+		c[1]++
+		counts[id] = c
+	}
+
+	imp.result = &Result{NoteTypes: []NoteTypeResult{}, Decks: []string{}}
+	for id, t := range imp.types {
+		imp.result.NoteTypes = append(imp.result.NoteTypes, NoteTypeResult{
+			NoteType: *t,
+			Mapping:  imp.mappings[id],
+			Notes:    counts[id][0],
+			Cards:    counts[id][1],
+		})
+	}
+	slices.SortFunc(imp.result.NoteTypes, func(a, b NoteTypeResult) int { return strings.Compare(a.Name, b.Name) })
+	imp.result.Notes = len(imp.notes)
+	return nil
+}
+
+// noteWord is the word and meaning read from a note
+type noteWord struct {
+	ref     models.WordRef
+	meaning string
+}
+
+// run imports the planned notes, cards and reviews
+func (imp *importer) run() error {
+	words, err := imp.words()
+	if err != nil {
+		return err
+	}
+	decks, err := imp.decks()
+	if err != nil {
+		return err
+	}
+	reviews, err := imp.col.Reviews()
+	if err != nil {
+		return err
+	}
+	byCard := make(map[int64][]Review)
+	for _, r := range reviews {
+		if r.Ease >= 1 && r.Ease <= 4 {
+			byCard[r.CardID] = append(byCard[r.CardID], r)
+		}
+	}
+
+	type existing struct {
+		WordID   uint
+		CardType string
+	}
+	var rows []existing
+	if err := imp.tx.Model(&models.SRSCard{}).Select("word_id, card_type").Where("user_id = ?", imp.userID).
+		Scan(&rows).Error; err != nil {
+		return fmt.Errorf("failed to load cards: %w", err)
+	}
+	have := make(map[existing]bool, len(rows))
+	for _, row := range rows {
+		have[row] = true
+	}
+
+	var created []models.SRSCard
+	var sources []int64
+	deckTypes := make(map[uint][]string)
+	for _, card := range imp.cards {
+		w, ok := words[card.NoteID]
+		m := imp.mappings[imp.noteType[card.NoteID]]
+		if !ok || card.Ord >= len(m.CardTypes) || m.CardTypes[card.Ord] == "" {
+			imp.result.CardsSkipped++
+			continue
+		}
+		key := existing{w.word.ID, m.CardTypes[card.Ord]}
+		if have[key] {
+			imp.result.CardsSkipped++
+			continue
+		}
+		have[key] = true
+
+		deckID := decks[homeDeck(card)]
+		c := cards.New(imp.userID, deckID, key.CardType, cards.Note{Word: w.word, Definition: w.meaning}, imp.now)
+		imp.schedule(&c, card, byCard[card.ID])
+		created = append(created, c)
+		sources = append(sources, card.ID)
+		if !slices.Contains(deckTypes[deckID], key.CardType) {
+			deckTypes[deckID] = append(deckTypes[deckID], key.CardType)
+		}
+	}
+	if len(created) > 0 {
+		if err := imp.tx.Omit("Word").CreateInBatches(&created, batchSize).Error; err != nil {
+			return fmt.Errorf("failed to create cards: %w", err)
+		}
+	}
+	imp.result.CardsCreated = len(created)
+	if err := imp.addDeckTypes(deckTypes); err != nil {
+		return err
+	}
+
+	var history []models.ReviewHistory
+	for i, card := range created {
+		history = append(history, imp.history(&card, byCard[sources[i]])...)
+	}
+	if len(history) > 0 {
+		if err := imp.tx.CreateInBatches(&history, batchSize).Error; err != nil {
+			return fmt.Errorf("failed to import review log: %w", err)
+		}
+	}
+	imp.result.Reviews = len(history)
+	return nil
+}
+
+// importedWord is the dictionary word a note maps to
+type importedWord struct {
+	word    *models.Word
+	meaning string
+}
+
+// words reads each mapped note's word, finding it in the dictionary or
+// adding it, and returns them by note ID
+func (imp *importer) words() (map[int64]importedWord, error) {
+	var ids []int64
+	var read []noteWord
+	for _, n := range imp.notes {
+		t, m := imp.types[n.TypeID], imp.mappings[n.TypeID]
+		if t == nil || m.Skip {
+			imp.result.NotesSkipped++
+			continue
+		}
+		field := func(name string) string {
+			if i := slices.Index(t.Fields, name); name != "" && i >= 0 && i < len(n.Fields) {
+				return n.Fields[i]
+			}
+			return ""
+		}
+		text := field(m.Word)
+		if t.Cloze {
+			text = clozeAnswer(text)
+		}
+		word, reading := knowledge.AnkiWord(text)
+		if r := knowledge.AnkiText(field(m.Reading)); r != "" {
+			// A reading field may use furigana syntax too
+			if _, ruby := knowledge.AnkiWord(r); ruby != "" {
+				r = ruby
+			}
+			reading = r
+		}
+		ref := models.WordRef{Word: word, Reading: reading}
+		if word == "" || !WordFits(ref) {
+			imp.result.NotesSkipped++
+			continue
+		}
+		ids = append(ids, n.ID)
+		read = append(read, noteWord{ref, knowledge.AnkiText(field(m.Meaning))})
+	}
+
+	refs := make([]models.WordRef, len(read))
+	for i := range read {
+		refs[i] = read[i].ref
+	}
+	found, created, err := FindWords(imp.tx, refs)
+	if err != nil {
+		return nil, err
+	}
+	imp.result.WordsCreated = created
+	words := make(map[int64]importedWord, len(ids))
+	for i, id := range ids {
+		if found[i] != nil {
+			words[id] = importedWord{found[i], read[i].meaning}
+		}
+	}
+	return words, nil
+}
+
+// WordFits reports whether a word and its reading fit the dictionary once
+// normalized
+func WordFits(ref models.WordRef) bool {
+	return utf8.RuneCountInString(textproc.NormalizeString(ref.Word)) <= MaxWordLength &&
+		utf8.RuneCountInString(textproc.NormalizeString(ref.Reading)) <= MaxWordLength
+}
+
+// FindWords looks the words up in the dictionary, adding those it lacks, and
+// returns them in order with how many were added. Of several entries with
+// the same form, the first is taken. Words must fit, see WordFits.
+func FindWords(tx *gorm.DB, refs []models.WordRef) ([]*models.Word, int, error) {
+	matches, err := knowledge.Resolve(tx, refs)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	wordIDs := make([]uint, len(matches))
+	var missing []models.Word
+	for i, m := range matches {
+		switch {
+		case m.Resolved():
+			wordIDs[i] = m.WordID
+		case m.Ambiguous():
+			wordIDs[i] = m.Candidates[0].ID
+		default:
+			missing = append(missing, models.Word{SurfaceForm: m.Ref.Word, Reading: newReading(m.Ref), BaseForm: m.Ref.Word})
+		}
+	}
+	added, created, err := addWords(tx, missing)
+	if err != nil {
+		return nil, 0, err
+	}
+	for i, m := range matches {
+		if wordIDs[i] == 0 {
+			wordIDs[i] = added[[2]string{m.Ref.Word, newReading(m.Ref)}]
+		}
+	}
+
+	loaded := make(map[uint]*models.Word)
+	for start := 0; start < len(wordIDs); start += batchSize {
+		var batch []models.Word
+		if err := tx.Where("id IN ?", wordIDs[start:min(start+batchSize, len(wordIDs))]).Find(&batch).Error; err != nil {
+			return nil, 0, fmt.Errorf("failed to load words: %w", err)
+		}
+		for i := range batch {
+			loaded[batch[i].ID] = &batch[i]
+		}
+	}
+	words := make([]*models.Word, len(wordIDs))
+	for i, id := range wordIDs {
+		words[i] = loaded[id]
+	}
+	return words, created, nil
+}
+
+// clozePattern matches a cloze deletion, {{c1::answer}} or {{c1::answer::hint}}
+var clozePattern = regexp.MustCompile(`\{\{c\d+::(.*?)(?:::.*?)?\}\}`)
+
+// clozeAnswer returns the text of a cloze field's first deletion, or the
+// whole text if it has none
+func clozeAnswer(s string) string {
+	if m := clozePattern.FindStringSubmatch(s); m != nil {
+		return m[1]
+	}
+	return s
+}
+
+// newReading is the reading a word added to the dictionary gets: the one
+// given, or the word itself in hiragana if it is all kana
+func newReading(ref models.WordRef) string {
+	if ref.Reading != "" || ref.Word == "" {
+		return ref.Reading
+	}
+	for _, r := range ref.Word {
+		if !textproc.IsKana(r) {
+			return ""
+		}
+	}
+	return textproc.ToHiragana(ref.Word)
+}
+
+// addWords adds words to the dictionary and returns the IDs of the given
+// forms and readings, whether added now or already there, with how many
+// were added
+func addWords(tx *gorm.DB, words []models.Word) (map[[2]string]uint, int, error) {
+	ids := make(map[[2]string]uint)
+	if len(words) == 0 {
+		return ids, 0, nil
+	}
+	result := tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "surface_form"}, {Name: "reading"}},
+		DoNothing: true,
+	}).CreateInBatches(&words, batchSize)
+	if result.Error != nil {
+		return nil, 0, fmt.Errorf("failed to add words: %w", result.Error)
+	}
+
+	forms := make([]string, 0, len(words))
+	for _, w := range words {
+		forms = append(forms, w.SurfaceForm)
+	}
+	for start := 0; start < len(forms); start += batchSize {
+		var batch []models.Word
+		if err := tx.Select("id", "surface_form", "reading").
+			Where("surface_form IN ?", forms[start:min(start+batchSize, len(forms))]).Find(&batch).Error; err != nil {
+			return nil, 0, fmt.Errorf("failed to load words: %w", err)
+		}
+		for _, w := range batch {
+			ids[[2]string{w.SurfaceForm, w.Reading}] = w.ID
+		}
+	}
+	return ids, int(result.RowsAffected), nil
+}
+
+// decks finds or creates the user's deck for each Anki deck that is home to
+// a card, and returns them by Anki deck ID. Anki's default deck, and decks
+// the package lacks, map to the user's default deck.
+func (imp *importer) decks() (map[int64]uint, error) {
+	ankiDecks, err := imp.col.Decks()
+	if err != nil {
+		return nil, err
+	}
+	home, err := cards.DefaultDeck(imp.tx, imp.userID)
+	if err != nil {
+		return nil, err
+	}
+
+	decks := make(map[int64]uint)
+	for _, card := range imp.cards {
+		id := homeDeck(card)
+		if _, ok := decks[id]; ok {
+			continue
+		}
+		d, ok := ankiDecks[id]
+		if !ok || id == defaultDeckID || d.Filtered {
+			decks[id] = home.ID
+			continue
+		}
+
+		name := []rune(strings.TrimSpace(d.Name))
+		deck := models.Deck{
+			UserID:       imp.userID,
+			Name:         string(name[:min(len(name), 100)]),
+			CardTypes:    []string{},
+			BurySiblings: true,
+		}
+		result := imp.tx.Where("user_id = ? AND name = ?", imp.userID, deck.Name).
+			Attrs(deck).FirstOrCreate(&deck)
+		if result.Error != nil {
+			return nil, fmt.Errorf("failed to create deck %q: %w", deck.Name, result.Error)
+		}
+		if result.RowsAffected > 0 {
+			imp.created = append(imp.created, deck.ID)
+		}
+		if deck.IsFiltered {
+			deck = *home
+		}
+		decks[id] = deck.ID
+		if !slices.Contains(imp.result.Decks, deck.Name) {
+			imp.result.Decks = append(imp.result.Decks, deck.Name)
+		}
+	}
+	return decks, nil
+}
+
+// addDeckTypes turns on the card types imported into each deck the import
+// created. Decks the user had keep their card types, which would otherwise
+// add cards of the new types to every word in them.
+func (imp *importer) addDeckTypes(types map[uint][]string) error {
+	for _, id := range imp.created {
+		added := types[id]
+		var deck models.Deck
+		if err := imp.tx.First(&deck, id).Error; err != nil {
+			return fmt.Errorf("failed to load deck %d: %w", id, err)
+		}
+		changed := false
+		for _, ct := range added {
+			if !slices.Contains(deck.CardTypes, ct) {
+				deck.CardTypes = append(deck.CardTypes, ct)
+				changed = true
+			}
+		}
+		if changed {
+			if err := imp.tx.Model(&deck).Select("card_types").Updates(&deck).Error; err != nil {
+				return fmt.Errorf("failed to update deck %d: %w", id, err)
+			}
+		}
+	}
+	return nil
+}
+
+// schedule carries an Anki card's scheduling and statistics over to a card
+func (imp *importer) schedule(c *models.SRSCard, card Card, reviews []Review) {
+	switch card.Type {
+	case 1:
+		c.State = models.CardStateLearning
+	case 2:
+		c.State = models.CardStateReview
+	case 3:
+		c.State = models.CardStateRelearning
+	default:
+		c.State = models.CardStateNew
+	}
+	c.IsSuspended = card.Queue == -1
+	c.EaseFactor = srs.DefaultSM2Settings.StartingEase
+	if card.Factor > 0 {
+		c.EaseFactor = float64(card.Factor) / 1000
+	}
+	c.IntervalDays = max(card.Interval, 1)
+	c.Lapses = card.Lapses
+	c.TotalReviews = card.Reps
+	if c.State != models.CardStateNew {
+		due := card.Due
+		if card.OriginalDeckID != 0 && card.OriginalDue != 0 {
+			due = card.OriginalDue
+		}
+		c.DueDate = imp.col.dueTime(due)
+	}
+
+	var memory struct {
+		S float64 `json:"s"`
+		D float64 `json:"d"`
+	}
+	if card.Data != "" && json.Unmarshal([]byte(card.Data), &memory) == nil {
+		c.Stability, c.Difficulty = memory.S, memory.D
+	}
+
+	if len(reviews) == 0 {
+		return
+	}
+	var s stats
+	for _, r := range reviews {
+		s.add(r)
+	}
+	c.TotalReviews = s.total
+	c.CorrectReviews = s.correct
+	c.CurrentStreak = s.streak
+	c.LongestStreak = s.longest
+	c.RepetitionCount = s.streak
+	c.LastReviewedAt = s.last
+}
+
+// history turns a card's review log into its review history
+func (imp *importer) history(c *models.SRSCard, reviews []Review) []models.ReviewHistory {
+	var history []models.ReviewHistory
+	var s stats
+	ease := srs.DefaultSM2Settings.StartingEase
+	var due time.Time
+	for i, r := range reviews {
+		at := time.UnixMilli(r.ID)
+		if due.IsZero() {
+			due = at
+		}
+		h := models.ReviewHistory{
+			UserID:          imp.userID,
+			CardID:          c.ID,
+			ReviewedAt:      at,
+			ResponseQuality: r.Ease,
+			OldState:        oldState(r, i == 0),
+			OldInterval:     max(r.LastIvl, 0),
+			OldEaseFactor:   ease,
+			OldDueDate:      due,
+
+			OldLapses:         s.lapses,
+			OldRepetitions:    s.streak,
+			OldStreak:         s.streak,
+			OldLongestStreak:  s.longest,
+			OldLastReviewedAt: s.last,
+			OldDeckID:         c.DeckID,
+
+			NewInterval:   max(r.Interval, 0),
+			ReviewContext: ReviewContext,
+		}
+		if r.TimeMs > 0 {
+			ms := r.TimeMs
+			h.ResponseTimeMs = &ms
+		}
+		if r.Factor > 0 {
+			ease = float64(r.Factor) / 1000
+		}
+		h.NewEaseFactor = ease
+		h.NewState = newState(r, h.OldState)
+		if r.Interval < 0 {
+			due = at.Add(time.Duration(-r.Interval) * time.Second)
+		} else {
+			due = at.AddDate(0, 0, r.Interval)
+		}
+		h.NewDueDate = due
+		if h.OldState == models.CardStateReview && r.Ease == 1 {
+			s.lapses++
+		}
+		s.add(r)
+		history = append(history, h)
+	}
+	return history
+}
+
+// stats are the review counts of a card as its log is read
+type stats struct {
+	total, correct  int
+	streak, longest int
+	lapses          int
+	last            *time.Time
+}
+
+// add counts one review
+func (s *stats) add(r Review) {
+	s.total++
+	if r.Ease > 1 {
+		s.correct++
+		s.streak++
+		s.longest = max(s.longest, s.streak)
+	} else {
+		s.streak = 0
+	}
+	at := time.UnixMilli(r.ID)
+	s.last = &at
+}
+
+// oldState is the state of a card before the review
+func oldState(r Review, first bool) string {
+	switch {
+	case first && r.Type == 0:
+		return models.CardStateNew
+	case r.Type == 0:
+		return models.CardStateLearning
+	case r.Type == 2:
+		return models.CardStateRelearning
+	case r.Type == 3 && r.LastIvl <= 0:
+		return models.CardStateLearning
+	}
+	return models.CardStateReview
+}
+
+// newState is the state of a card after the review
+func newState(r Review, old string) string {
+	switch {
+	case r.Interval > 0:
+		return models.CardStateReview
+	case old == models.CardStateReview || old == models.CardStateRelearning:
+		return models.CardStateRelearning
+	}
+	return models.CardStateLearning
+}
+
+// homeDeck is the deck a card belongs to outside any filtered deck
+func homeDeck(card Card) int64 {
+	if card.OriginalDeckID != 0 {
+		return card.OriginalDeckID
+	}
+	return card.DeckID
+}
+
+// dueTime converts a due date of a card studied before: a Unix time for
+// cards in learning, else a day number counted from the collection's
+// creation
+func (c *Collection) dueTime(due int64) time.Time {
+	if due > 1_000_000_000 {
+		return time.Unix(due, 0)
+	}
+	return c.Created.AddDate(0, 0, int(due))
+}
@@ -0,0 +1,178 @@
+package cards
+
+import (
+	"fmt"
+	"time"
+
+	"japanese-learning-app/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DefaultDeckName is the name of the deck cards go to when none is given
+const DefaultDeckName = "Default"
+
+// DefaultDeck returns the user's default deck, creating it on first use.
+// Cards made before the user had decks are moved into it.
+func DefaultDeck(tx *gorm.DB, userID uint) (*models.Deck, error) {
+	var deck models.Deck
+	err := tx.Where("user_id = ? AND is_default = ?", userID, true).First(&deck).Error
+	if err == nil {
+		return &deck, nil
+	}
+	if err != gorm.ErrRecordNotFound {
+		return nil, fmt.Errorf("failed to load default deck: %w", err)
+	}
+
+	deck = models.Deck{
+		UserID:       userID,
+		Name:         DefaultDeckName,
+		IsDefault:    true,
+		CardTypes:    []string{models.CardTypeRecognition},
+		BurySiblings: true,
+	}
+	result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&deck)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to create default deck: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		// Created concurrently
+		if err := tx.Where("user_id = ? AND is_default = ?", userID, true).First(&deck).Error; err != nil {
+			return nil, fmt.Errorf("failed to load default deck: %w", err)
+		}
+		return &deck, nil
+	}
+	err = tx.Model(&models.SRSCard{}).Where("user_id = ? AND deck_id IS NULL", userID).
+		Update("deck_id", deck.ID).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to move cards to the default deck: %w", err)
+	}
+	return &deck, nil
+}
+
+// Insert creates a card unless the user already has one for the word and
+// type, in which case card is replaced by the existing one. It reports
+// whether the card was created.
+func Insert(tx *gorm.DB, card *models.SRSCard) (bool, error) {
+	result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(card)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected > 0 {
+		return true, nil
+	}
+	err := tx.Where("user_id = ? AND word_id = ? AND card_type = ?", card.UserID, card.WordID, card.CardType).First(card).Error
+	return false, err
+}
+
+// New renders a new card of the given type for the note
+func New(userID uint, deckID uint, cardType string, note Note, now time.Time) models.SRSCard {
+	card := models.SRSCard{
+		UserID:   userID,
+		DeckID:   &deckID,
+		WordID:   note.Word.ID,
+		CardType: cardType,
+		State:    models.CardStateNew,
+		DueDate:  now,
+	}
+	card.FrontContent, card.BackContent = Templates[cardType].Render(note)
+	return card
+}
+
+// AddMissingTypes gives every word with template cards in the deck, or
+// borrowed from it, a card of each of the given types, made from one of the
+// word's existing cards. It returns the number of cards created.
+func AddMissingTypes(tx *gorm.DB, deck *models.Deck, cardTypes []string) (int, error) {
+	var existing []models.SRSCard
+	err := tx.Preload("Word").
+		Where("(deck_id = ? OR original_deck_id = ?) AND card_type IN ?", deck.ID, deck.ID, TemplateTypes).
+		Order("id").Find(&existing).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to load deck cards: %w", err)
+	}
+
+	have := make(map[uint]map[string]bool)
+	var sources []*models.SRSCard
+	for i := range existing {
+		card := &existing[i]
+		if have[card.WordID] == nil {
+			have[card.WordID] = make(map[string]bool)
+			sources = append(sources, card)
+		}
+		have[card.WordID][card.CardType] = true
+	}
+
+	created := 0
+	now := time.Now()
+	for _, source := range sources {
+		note := NoteFromCard(source)
+		for _, cardType := range cardTypes {
+			if have[source.WordID][cardType] {
+				continue
+			}
+			card := New(deck.UserID, deck.ID, cardType, note, now)
+			ok, err := Insert(tx, &card)
+			if err != nil {
+				return created, fmt.Errorf("failed to create card: %w", err)
+			}
+			if ok {
+				created++
+			}
+		}
+	}
+	return created, nil
+}
+
+// Move puts the cards in the deck. Cards a filtered deck has stay there
+// and go to the new deck when it is emptied.
+func Move(tx *gorm.DB, ids []uint, deckID uint) error {
+	err := tx.Model(&models.SRSCard{}).Where("id IN ? AND original_deck_id IS NULL", ids).
+		Update("deck_id", deckID).Error
+	if err == nil {
+		err = tx.Model(&models.SRSCard{}).Where("id IN ? AND original_deck_id IS NOT NULL", ids).
+			Update("original_deck_id", deckID).Error
+	}
+	if err != nil {
+		return fmt.Errorf("failed to move cards to deck %d: %w", deckID, err)
+	}
+	return nil
+}
+
+// BurySiblings hides the other new and review cards of the card's word
+// until the given time, so one word is not asked twice on the same day
+func BurySiblings(tx *gorm.DB, card *models.SRSCard, until time.Time) error {
+	err := tx.Model(&models.SRSCard{}).
+		Where("user_id = ? AND word_id = ? AND id <> ?", card.UserID, card.WordID, card.ID).
+		Where("card_type IN ? AND state IN ? AND due_date < ?", TemplateTypes, []string{models.CardStateNew, models.CardStateReview}, until).
+		Where("is_suspended = ? AND is_buried = ?", false, false).
+		Updates(map[string]interface{}{"is_buried": true, "buried_until": until}).Error
+	if err != nil {
+		return fmt.Errorf("failed to bury siblings of card %d: %w", card.ID, err)
+	}
+	return nil
+}
+
+// UnburySiblings brings back the card's siblings that were buried until the
+// given time
+func UnburySiblings(tx *gorm.DB, card *models.SRSCard, until time.Time) error {
+	err := tx.Model(&models.SRSCard{}).
+		Where("user_id = ? AND word_id = ? AND id <> ?", card.UserID, card.WordID, card.ID).
+		Where("is_buried = ? AND buried_until = ?", true, until).
+		Updates(map[string]interface{}{"is_buried": false, "buried_until": nil}).Error
+	if err != nil {
+		return fmt.Errorf("failed to unbury siblings of card %d: %w", card.ID, err)
+	}
+	return nil
+}
+
+// Unbury brings back the user's cards whose burial has run out
+func Unbury(tx *gorm.DB, userID uint, now time.Time) error {
+	err := tx.Model(&models.SRSCard{}).
+		Where("user_id = ? AND is_buried = ? AND buried_until <= ?", userID, true, now).
+		Updates(map[string]interface{}{"is_buried": false, "buried_until": nil}).Error
+	if err != nil {
+		return fmt.Errorf("failed to unbury cards: %w", err)
+	}
+	return nil
+}
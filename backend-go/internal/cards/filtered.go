@@ -0,0 +1,103 @@
+package cards
+
+import (
+	"fmt"
+	"time"
+
+	"japanese-learning-app/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// DefaultFilterLimit is how many cards a filtered deck takes when its filter
+// sets no limit
+const DefaultFilterLimit = 100
+
+// Matching returns a query of the user's cards the filter selects. Due
+// dates are counted in days ending at dayEnd, the end of the current study
+// day.
+func Matching(tx *gorm.DB, userID uint, filter *models.DeckFilter, dayEnd time.Time) *gorm.DB {
+	q := tx.Model(&models.SRSCard{}).Where("srs_cards.user_id = ?", userID)
+	if filter.DeckID != nil {
+		q = q.Where("srs_cards.deck_id = ?", *filter.DeckID)
+	}
+	if filter.BookID != nil {
+		q = q.Where("srs_cards.word_id IN (?)", tx.Model(&models.BookWord{}).Select("word_id").Where("book_id = ?", *filter.BookID))
+	}
+	if filter.JLPTLevel != nil {
+		q = q.Where("srs_cards.word_id IN (?)", tx.Model(&models.Word{}).Select("id").Where("jlpt_level = ?", *filter.JLPTLevel))
+	}
+	if filter.DueWithinDays != nil {
+		q = q.Where("srs_cards.state <> ? AND srs_cards.due_date < ?", models.CardStateNew, dayEnd.AddDate(0, 0, *filter.DueWithinDays))
+	}
+	if len(filter.States) > 0 {
+		q = q.Where("srs_cards.state IN ?", filter.States)
+	}
+	if filter.Leech {
+		q = q.Where("srs_cards.is_leech = ?", true)
+	}
+	return q
+}
+
+// Build empties the filtered deck and fills it again with the cards its
+// filter selects, most overdue first. Suspended and buried cards and cards
+// another filtered deck has are left out. It returns the number of cards
+// borrowed.
+func Build(tx *gorm.DB, deck *models.Deck, dayEnd time.Time) (int, error) {
+	if err := Empty(tx, deck); err != nil {
+		return 0, err
+	}
+	limit := DefaultFilterLimit
+	if deck.Filter.Limit > 0 {
+		limit = deck.Filter.Limit
+	}
+
+	var ids []uint
+	err := Matching(tx, deck.UserID, deck.Filter, dayEnd).
+		Where("srs_cards.original_deck_id IS NULL AND srs_cards.is_suspended = ? AND srs_cards.is_buried = ?", false, false).
+		Order("srs_cards.due_date").Order("srs_cards.id").Limit(limit).Pluck("srs_cards.id", &ids).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to select cards for deck %d: %w", deck.ID, err)
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	err = tx.Model(&models.SRSCard{}).Where("id IN ?", ids).Updates(map[string]interface{}{
+		"original_deck_id": gorm.Expr("deck_id"),
+		"deck_id":          deck.ID,
+	}).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to fill deck %d: %w", deck.ID, err)
+	}
+	return len(ids), nil
+}
+
+// Empty hands every card the filtered deck has back to its home deck
+func Empty(tx *gorm.DB, deck *models.Deck) error {
+	err := tx.Model(&models.SRSCard{}).Where("deck_id = ? AND original_deck_id IS NOT NULL", deck.ID).
+		Updates(map[string]interface{}{
+			"deck_id":          gorm.Expr("original_deck_id"),
+			"original_deck_id": nil,
+		}).Error
+	if err != nil {
+		return fmt.Errorf("failed to empty deck %d: %w", deck.ID, err)
+	}
+	return nil
+}
+
+// ReturnHome hands a card a filtered deck has back to its home deck
+func ReturnHome(card *models.SRSCard) {
+	if card.OriginalDeckID != nil {
+		card.DeckID = card.OriginalDeckID
+		card.OriginalDeckID = nil
+	}
+}
+
+// HomeDeckID returns the deck the card belongs to, whether or not a
+// filtered deck has it
+func HomeDeckID(card *models.SRSCard) *uint {
+	if card.OriginalDeckID != nil {
+		return card.OriginalDeckID
+	}
+	return card.DeckID
+}
@@ -0,0 +1,115 @@
+package cards
+
+import (
+	"japanese-learning-app/internal/models"
+)
+
+// Fields a template can put on a card
+const (
+	FieldText       = "text"       // The word as written
+	FieldFurigana   = "furigana"   // Its reading
+	FieldDefinition = "definition" // Dictionary senses
+	FieldExample    = "example"    // Sentence the word was taken from
+)
+
+// Template lists the fields on each side of a card of one type
+type Template struct {
+	Front []string
+	Back  []string
+}
+
+// Templates are the card types made from a word, by card type
+var Templates = map[string]Template{
+	models.CardTypeRecognition: {
+		Front: []string{FieldText},
+		Back:  []string{FieldFurigana, FieldDefinition, FieldExample},
+	},
+	models.CardTypeRecall: {
+		Front: []string{FieldDefinition},
+		Back:  []string{FieldText, FieldFurigana, FieldExample},
+	},
+	models.CardTypeProduction: {
+		Front: []string{FieldDefinition, FieldFurigana},
+		Back:  []string{FieldText, FieldExample},
+	},
+}
+
+// TemplateTypes are the card types of Templates, in display order
+var TemplateTypes = []string{models.CardTypeRecognition, models.CardTypeRecall, models.CardTypeProduction}
+
+// Example is the sentence a card's word was taken from
+type Example struct {
+	Text          string `json:"text"`
+	BookID        uint   `json:"book_id"`
+	BookTitle     string `json:"book_title"`
+	Chapter       string `json:"chapter,omitempty"`
+	StartPosition int    `json:"start_position"`
+	EndPosition   int    `json:"end_position"`
+}
+
+// Note is what the cards of a word are made from
+type Note struct {
+	Word       *models.Word
+	Definition string
+	Example    *Example // Optional
+}
+
+// Render lays out the front and back of a card with the template
+func (t Template) Render(n Note) (front, back map[string]interface{}) {
+	return n.fields(t.Front), n.fields(t.Back)
+}
+
+func (n Note) fields(names []string) map[string]interface{} {
+	side := make(map[string]interface{}, len(names))
+	for _, name := range names {
+		switch name {
+		case FieldText:
+			side[name] = n.Word.SurfaceForm
+		case FieldFurigana:
+			side[name] = n.Word.Reading
+		case FieldDefinition:
+			side[name] = n.Definition
+		case FieldExample:
+			// Left out rather than null when there is no example
+			if n.Example != nil {
+				side[name] = n.Example
+			}
+		}
+	}
+	return side
+}
+
+// NoteFromCard recovers the note a card was rendered from, so sibling cards
+// of other types can be made without looking the word up again
+func NoteFromCard(card *models.SRSCard) Note {
+	n := Note{Word: &card.Word}
+	for _, side := range []map[string]interface{}{card.FrontContent, card.BackContent} {
+		if d, ok := side[FieldDefinition].(string); ok {
+			n.Definition = d
+		}
+		switch e := side[FieldExample].(type) {
+		case *Example:
+			n.Example = e
+		case map[string]interface{}:
+			n.Example = exampleFromJSON(e)
+		}
+	}
+	return n
+}
+
+func exampleFromJSON(m map[string]interface{}) *Example {
+	e := &Example{}
+	e.Text, _ = m["text"].(string)
+	e.BookTitle, _ = m["book_title"].(string)
+	e.Chapter, _ = m["chapter"].(string)
+	if v, ok := m["book_id"].(float64); ok {
+		e.BookID = uint(v)
+	}
+	if v, ok := m["start_position"].(float64); ok {
+		e.StartPosition = int(v)
+	}
+	if v, ok := m["end_position"].(float64); ok {
+		e.EndPosition = int(v)
+	}
+	return e
+}
@@ -22,11 +22,15 @@ type Config struct {
 	// File Upload
 	UploadDir     string
 	MaxFileSize   int64
+	MediaDir      string // AnkiConnect media, kept out of the public UploadDir
 
 	// External APIs
 	OpenAIAPIKey string
 	JishoAPIURL  string
 
+	// Word lists (JLPT levels, frequency ranks)
+	WordListDir string
+
 	// App Settings
 	Debug        bool
 	FrontendURL  string
@@ -53,11 +57,15 @@ func Load() *Config {
 		// File Upload
 		UploadDir:   getEnv("UPLOAD_DIR", "../data/uploads"),
 		MaxFileSize: getEnvInt64("MAX_FILE_SIZE", 50*1024*1024), // 50MB
+		MediaDir:    getEnv("MEDIA_DIR", "../data/media"),
 
 		// External APIs
 		OpenAIAPIKey: getEnv("OPENAI_API_KEY", ""),
 		JishoAPIURL:  getEnv("JISHO_API_URL", "https://jisho.org/api/v1/search/words"),
 
+		// Word lists
+		WordListDir: getEnv("WORDLIST_DIR", "../data/wordlists"),
+
 		// App Settings
 		Debug:       getEnvBool("DEBUG", true),
 		FrontendURL: getEnv("FRONTEND_URL", "http://localhost:3000"),
@@ -48,12 +48,17 @@ func Migrate(db *gorm.DB) error {
 		&models.Book{},
 		&models.ReadingSession{},
 		&models.BookAnnotation{},
+		&models.Word{},
+		&models.WordDefinition{},
+		&models.UserWordKnowledge{},
+		&models.BookWord{},
+		&models.BookSentence{},
+		&models.DictionaryCacheEntry{},
+		&models.Deck{},
+		&models.SRSCard{},
+		&models.ReviewHistory{},
+		&models.FSRSOptimization{},
 		// Add more models here as we create them
-		// &models.Word{},
-		// &models.WordDefinition{},
-		// &models.UserWordKnowledge{},
-		// &models.SRSCard{},
-		// &models.ReviewHistory{},
 	)
 
 	if err != nil {
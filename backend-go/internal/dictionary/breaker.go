@@ -0,0 +1,65 @@
+package dictionary
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned while the upstream dictionary is considered down
+var ErrCircuitOpen = errors.New("dictionary service unavailable (circuit open)")
+
+// breaker is a minimal circuit breaker. After threshold consecutive failures
+// it rejects calls for cooldown, then lets a single trial call through; the
+// trial's outcome closes the circuit again or restarts the cooldown.
+type breaker struct {
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	trial     bool
+}
+
+func newBreaker(threshold int, cooldown time.Duration) *breaker {
+	return &breaker{threshold: threshold, cooldown: cooldown, now: time.Now}
+}
+
+// allow reports whether a call may go ahead
+func (b *breaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures < b.threshold {
+		return nil
+	}
+	if b.now().Before(b.openUntil) || b.trial {
+		return ErrCircuitOpen
+	}
+	// Half-open: let one call through to probe the service
+	b.trial = true
+	return nil
+}
+
+// record reports the outcome of an allowed call
+func (b *breaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.trial = false
+	if errors.Is(err, context.Canceled) {
+		// The caller gave up; says nothing about the service
+		return
+	}
+	if err == nil {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.failures >= b.threshold {
+		b.openUntil = b.now().Add(b.cooldown)
+	}
+}
@@ -0,0 +1,169 @@
+package dictionary
+
+import (
+	"context"
+	"time"
+
+	"japanese-learning-app/internal/models"
+	"japanese-learning-app/internal/textproc"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Entry is a dictionary entry in the format returned to clients, whatever
+// dictionary it came from
+type Entry struct {
+	WordID    *uint   `json:"word_id,omitempty"` // Set for entries from the local dictionary
+	Word      string  `json:"word"`
+	Reading   string  `json:"reading"`
+	Source    string  `json:"source"`
+	IsCommon  bool    `json:"is_common,omitempty"`
+	JLPTLevel *int    `json:"jlpt_level,omitempty"`
+	Senses    []Sense `json:"senses"`
+}
+
+// Sense is one meaning of an entry
+type Sense struct {
+	Definitions   []string `json:"definitions"`
+	PartsOfSpeech []string `json:"parts_of_speech,omitempty"`
+	Tags          []string `json:"tags,omitempty"`
+}
+
+// Result is the outcome of a lookup
+type Result struct {
+	Query   string  `json:"query"`
+	Source  string  `json:"source"` // local, jisho or none
+	Entries []Entry `json:"entries"`
+}
+
+// Lookup sources reported in Result.Source
+const (
+	SourceLocal = "local"
+	SourceNone  = "none"
+)
+
+// Service looks words up in the local dictionaries and falls back to a
+// Jisho-compatible API when they have nothing
+type Service struct {
+	db    *gorm.DB
+	jisho *JishoClient
+}
+
+// NewService creates a dictionary service. jisho may be nil to disable the
+// fallback.
+func NewService(db *gorm.DB, jisho *JishoClient) *Service {
+	return &Service{db: db, jisho: jisho}
+}
+
+// Lookup finds entries for a word. Local entries with definitions win; the
+// fallback is only queried when there are none. If the fallback fails, the
+// local result (possibly empty) is returned together with the error.
+func (s *Service) Lookup(ctx context.Context, word string) (*Result, error) {
+	query := textproc.NormalizeString(word)
+	result := &Result{Query: query, Source: SourceNone, Entries: []Entry{}}
+
+	local, err := s.lookupLocal(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range local {
+		if len(e.Senses) > 0 {
+			result.Source = SourceLocal
+			result.Entries = local
+			return result, nil
+		}
+	}
+
+	if s.jisho == nil {
+		result.Entries = local
+		return result, nil
+	}
+	remote, err := s.jisho.Search(ctx, query)
+	if err != nil {
+		result.Entries = local
+		return result, err
+	}
+	result.Source = JishoSource
+	result.Entries = remote
+	return result, nil
+}
+
+// lookupLocal searches the words table by written form and reading
+func (s *Service) lookupLocal(ctx context.Context, query string) ([]Entry, error) {
+	var words []models.Word
+	err := s.db.WithContext(ctx).
+		Preload("Definitions", func(db *gorm.DB) *gorm.DB {
+			return db.Order("dictionary_source, definition_order")
+		}).
+		Where("surface_form = ? OR reading = ?", query, textproc.ToHiragana(query)).
+		Order("frequency_rank IS NULL, frequency_rank").
+		Limit(20).
+		Find(&words).Error
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]Entry, 0, len(words))
+	for i := range words {
+		entries = append(entries, EntryFromWord(&words[i]))
+	}
+	return entries, nil
+}
+
+// EntryFromWord converts a local word and its loaded definitions
+func EntryFromWord(w *models.Word) Entry {
+	id := w.ID
+	entry := Entry{
+		WordID:    &id,
+		Word:      w.SurfaceForm,
+		Reading:   w.Reading,
+		Source:    SourceLocal,
+		JLPTLevel: w.JLPTLevel,
+	}
+	for _, d := range w.Definitions {
+		sense := Sense{Definitions: []string{d.Definition}, Tags: d.Tags}
+		if w.PartOfSpeech != "" {
+			sense.PartsOfSpeech = []string{w.PartOfSpeech}
+		}
+		entry.Senses = append(entry.Senses, sense)
+	}
+	return entry
+}
+
+// DBCache is a Cache backed by the dictionary_cache table
+type DBCache struct {
+	db *gorm.DB
+}
+
+// NewDBCache creates a cache stored in the database
+func NewDBCache(db *gorm.DB) *DBCache {
+	return &DBCache{db: db}
+}
+
+// Get implements Cache
+func (c *DBCache) Get(ctx context.Context, source, query string) ([]byte, bool, error) {
+	var entry models.DictionaryCacheEntry
+	err := c.db.WithContext(ctx).
+		Where("source = ? AND query = ? AND expires_at > ?", source, query, time.Now()).
+		Limit(1).
+		Find(&entry).Error
+	if err != nil {
+		return nil, false, err
+	}
+	return entry.Response, entry.ID != 0, nil
+}
+
+// Set implements Cache
+func (c *DBCache) Set(ctx context.Context, source, query string, data []byte, ttl time.Duration) error {
+	entry := models.DictionaryCacheEntry{
+		Source:    source,
+		Query:     query,
+		Response:  data,
+		ExpiresAt: time.Now().Add(ttl),
+	}
+	return c.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "source"}, {Name: "query"}},
+		DoUpdates: clause.AssignmentColumns([]string{"response", "expires_at", "updated_at"}),
+	}).Create(&entry).Error
+}
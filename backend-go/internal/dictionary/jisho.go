@@ -0,0 +1,206 @@
+package dictionary
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// JishoSource is the cache and definition source name for Jisho results
+const JishoSource = "jisho"
+
+// Cache persists upstream responses between lookups
+type Cache interface {
+	// Get returns a cached response, or ok=false on a miss or expired entry
+	Get(ctx context.Context, source, query string) (data []byte, ok bool, err error)
+	Set(ctx context.Context, source, query string, data []byte, ttl time.Duration) error
+}
+
+// JishoOptions tunes the Jisho client. Zero values use the defaults.
+type JishoOptions struct {
+	Timeout           time.Duration // Per request; default 5s
+	RequestsPerSecond float64       // Default 1
+	Burst             int           // Default 3
+	FailureThreshold  int           // Consecutive failures that open the circuit; default 5
+	Cooldown          time.Duration // How long the circuit stays open; default 1m
+	CacheTTL          time.Duration // Default 30 days
+}
+
+// JishoClient queries a Jisho-compatible search endpoint
+// (https://jisho.org/api/v1/search/words?keyword=...)
+type JishoClient struct {
+	baseURL  string
+	http     *http.Client
+	cache    Cache
+	limiter  *limiter
+	breaker  *breaker
+	cacheTTL time.Duration
+}
+
+// NewJishoClient creates a client for the endpoint at baseURL. cache may be nil.
+func NewJishoClient(baseURL string, cache Cache, opts JishoOptions) *JishoClient {
+	if opts.Timeout == 0 {
+		opts.Timeout = 5 * time.Second
+	}
+	if opts.RequestsPerSecond == 0 {
+		opts.RequestsPerSecond = 1
+	}
+	if opts.Burst == 0 {
+		opts.Burst = 3
+	}
+	if opts.FailureThreshold == 0 {
+		opts.FailureThreshold = 5
+	}
+	if opts.Cooldown == 0 {
+		opts.Cooldown = time.Minute
+	}
+	if opts.CacheTTL == 0 {
+		opts.CacheTTL = 30 * 24 * time.Hour
+	}
+
+	return &JishoClient{
+		baseURL:  baseURL,
+		http:     &http.Client{Timeout: opts.Timeout},
+		cache:    cache,
+		limiter:  newLimiter(opts.RequestsPerSecond, opts.Burst),
+		breaker:  newBreaker(opts.FailureThreshold, opts.Cooldown),
+		cacheTTL: opts.CacheTTL,
+	}
+}
+
+// JishoResponse is the body returned by the search endpoint
+type JishoResponse struct {
+	Meta struct {
+		Status int `json:"status"`
+	} `json:"meta"`
+	Data []JishoEntry `json:"data"`
+}
+
+// JishoEntry is one search result
+type JishoEntry struct {
+	Slug     string   `json:"slug"`
+	IsCommon bool     `json:"is_common"`
+	Tags     []string `json:"tags"`
+	JLPT     []string `json:"jlpt"` // e.g. "jlpt-n5"
+	Japanese []struct {
+		Word    string `json:"word"`
+		Reading string `json:"reading"`
+	} `json:"japanese"`
+	Senses []struct {
+		EnglishDefinitions []string `json:"english_definitions"`
+		PartsOfSpeech      []string `json:"parts_of_speech"`
+		Tags               []string `json:"tags"`
+		Info               []string `json:"info"`
+	} `json:"senses"`
+}
+
+// Search looks up a keyword, serving it from the cache when possible
+func (c *JishoClient) Search(ctx context.Context, keyword string) ([]Entry, error) {
+	if c.cache != nil {
+		if data, ok, err := c.cache.Get(ctx, JishoSource, keyword); err == nil && ok {
+			var resp JishoResponse
+			if err := json.Unmarshal(data, &resp); err == nil {
+				return resp.entries(), nil
+			}
+		}
+	}
+
+	if err := c.breaker.allow(); err != nil {
+		return nil, err
+	}
+	data, err := c.fetch(ctx, keyword)
+	c.breaker.record(err)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp JishoResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, fmt.Errorf("invalid jisho response: %w", err)
+	}
+	if c.cache != nil {
+		// A failed cache write only costs a repeat request later
+		_ = c.cache.Set(ctx, JishoSource, keyword, data, c.cacheTTL)
+	}
+	return resp.entries(), nil
+}
+
+func (c *JishoClient) fetch(ctx context.Context, keyword string) ([]byte, error) {
+	if err := c.limiter.wait(ctx); err != nil {
+		return nil, err
+	}
+
+	u, err := url.Parse(c.baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid jisho URL: %w", err)
+	}
+	q := u.Query()
+	q.Set("keyword", keyword)
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("jisho request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("jisho returned status %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read jisho response: %w", err)
+	}
+	if !json.Valid(data) {
+		return nil, errors.New("jisho returned invalid JSON")
+	}
+	return data, nil
+}
+
+// entries converts a Jisho response to the common entry format
+func (r *JishoResponse) entries() []Entry {
+	entries := make([]Entry, 0, len(r.Data))
+	for _, d := range r.Data {
+		entry := Entry{
+			Source:   JishoSource,
+			IsCommon: d.IsCommon,
+		}
+		if len(d.Japanese) > 0 {
+			entry.Word = d.Japanese[0].Word
+			entry.Reading = d.Japanese[0].Reading
+			if entry.Word == "" {
+				// Kana-only words have no separate written form
+				entry.Word = entry.Reading
+			}
+		}
+		for _, tag := range d.JLPT {
+			level, err := strconv.Atoi(strings.TrimPrefix(tag, "jlpt-n"))
+			if err == nil && level >= 1 && level <= 5 && (entry.JLPTLevel == nil || level > *entry.JLPTLevel) {
+				entry.JLPTLevel = &level
+			}
+		}
+		for _, s := range d.Senses {
+			entry.Senses = append(entry.Senses, Sense{
+				Definitions:   s.EnglishDefinitions,
+				PartsOfSpeech: s.PartsOfSpeech,
+				Tags:          slices.Concat(s.Tags, s.Info),
+			})
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
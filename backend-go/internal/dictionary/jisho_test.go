@@ -0,0 +1,183 @@
+package dictionary
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const jishoBody = `{
+  "meta": {"status": 200},
+  "data": [{
+    "slug": "食べる",
+    "is_common": true,
+    "jlpt": ["jlpt-n5"],
+    "japanese": [{"word": "食べる", "reading": "たべる"}],
+    "senses": [{"english_definitions": ["to eat"], "parts_of_speech": ["Ichidan verb"], "tags": [], "info": []}]
+  }]
+}`
+
+// memoryCache is an in-memory Cache for tests
+type memoryCache struct {
+	mu   sync.Mutex
+	data map[string][]byte
+}
+
+func (m *memoryCache) Get(_ context.Context, source, query string) ([]byte, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	d, ok := m.data[source+"|"+query]
+	return d, ok, nil
+}
+
+func (m *memoryCache) Set(_ context.Context, source, query string, data []byte, _ time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.data == nil {
+		m.data = make(map[string][]byte)
+	}
+	m.data[source+"|"+query] = data
+	return nil
+}
+
+func fastOptions() JishoOptions {
+	return JishoOptions{
+		Timeout:           time.Second,
+		RequestsPerSecond: 1000,
+		Burst:             100,
+		FailureThreshold:  2,
+		Cooldown:          time.Hour,
+	}
+}
+
+func TestJishoSearchParsesAndCaches(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if got := r.URL.Query().Get("keyword"); got != "食べる" {
+			t.Errorf("keyword = %q, want 食べる", got)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(jishoBody))
+	}))
+	defer srv.Close()
+
+	client := NewJishoClient(srv.URL, &memoryCache{}, fastOptions())
+	for i := 0; i < 2; i++ {
+		entries, err := client.Search(context.Background(), "食べる")
+		if err != nil {
+			t.Fatalf("Search: %v", err)
+		}
+		if len(entries) != 1 {
+			t.Fatalf("got %d entries, want 1", len(entries))
+		}
+		e := entries[0]
+		if e.Word != "食べる" || e.Reading != "たべる" || e.Source != JishoSource {
+			t.Errorf("unexpected entry %+v", e)
+		}
+		if e.JLPTLevel == nil || *e.JLPTLevel != 5 {
+			t.Errorf("JLPT level = %v, want 5", e.JLPTLevel)
+		}
+		if len(e.Senses) != 1 || e.Senses[0].Definitions[0] != "to eat" {
+			t.Errorf("unexpected senses %+v", e.Senses)
+		}
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("upstream called %d times, want 1 (second lookup should be cached)", n)
+	}
+}
+
+func TestJishoCircuitOpensAfterFailures(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	client := NewJishoClient(srv.URL, nil, fastOptions())
+	for i := 0; i < 2; i++ {
+		if _, err := client.Search(context.Background(), "猫"); err == nil {
+			t.Fatal("expected an error from a failing upstream")
+		}
+	}
+	if _, err := client.Search(context.Background(), "猫"); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("err = %v, want ErrCircuitOpen", err)
+	}
+	if n := calls.Load(); n != 2 {
+		t.Errorf("upstream called %d times, want 2", n)
+	}
+}
+
+func TestJishoCircuitRecoversAfterCooldown(t *testing.T) {
+	var healthy atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte(jishoBody))
+	}))
+	defer srv.Close()
+
+	client := NewJishoClient(srv.URL, nil, fastOptions())
+	now := time.Now()
+	client.breaker.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		client.Search(context.Background(), "猫")
+	}
+	healthy.Store(true)
+	if _, err := client.Search(context.Background(), "猫"); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("err = %v, want ErrCircuitOpen during cooldown", err)
+	}
+
+	now = now.Add(2 * time.Hour)
+	if _, err := client.Search(context.Background(), "猫"); err != nil {
+		t.Fatalf("trial request after cooldown failed: %v", err)
+	}
+	if _, err := client.Search(context.Background(), "猫"); err != nil {
+		t.Fatalf("circuit did not close after a successful trial: %v", err)
+	}
+}
+
+func TestJishoTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(2 * time.Second):
+		}
+	}))
+	defer srv.Close()
+
+	opts := fastOptions()
+	opts.Timeout = 50 * time.Millisecond
+	client := NewJishoClient(srv.URL, nil, opts)
+
+	start := time.Now()
+	if _, err := client.Search(context.Background(), "猫"); err == nil {
+		t.Fatal("expected a timeout error")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("request took %v, timeout not applied", elapsed)
+	}
+}
+
+func TestLimiterSpacesRequests(t *testing.T) {
+	l := newLimiter(20, 1)
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := l.wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// First token is free, the next two take 50ms each
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("3 requests at 20/s with burst 1 took %v, want >= 100ms", elapsed)
+	}
+}
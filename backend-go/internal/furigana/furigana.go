@@ -0,0 +1,266 @@
+package furigana
+
+import (
+	"sort"
+
+	"japanese-learning-app/internal/textproc"
+	"japanese-learning-app/internal/tokenizer"
+)
+
+// Reading sources
+const (
+	SourceAuthor    = "author"
+	SourceGenerated = "generated"
+)
+
+// Segment is a run of text with an optional reading to display above it
+type Segment struct {
+	Text    string `json:"text"`
+	Reading string `json:"reading,omitempty"`
+	Source  string `json:"source,omitempty"` // author, generated
+
+	// Start and End are rune offsets into the book's extracted text
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// Ruby is a reading supplied by the book itself for a span of text
+type Ruby struct {
+	Start   int    `json:"start"`
+	End     int    `json:"end"`
+	Reading string `json:"reading"`
+}
+
+// Knowledge describes what a reader already knows, so that readings can be
+// phased out word by word
+type Knowledge struct {
+	// KnownWords holds WordKey values of words the user no longer needs
+	// readings for
+	KnownWords map[string]bool
+
+	// KnownKanji holds kanji the user has learned. Words written only with
+	// learned kanji are shown without readings.
+	KnownKanji map[rune]bool
+}
+
+// WordKey identifies a dictionary word by base form and reading
+func WordKey(baseForm, reading string) string {
+	return baseForm + "\x00" + reading
+}
+
+// Hides reports whether the token should be shown without a reading
+func (k *Knowledge) Hides(tok tokenizer.Token) bool {
+	if k == nil {
+		return false
+	}
+	if k.KnownWords[WordKey(tok.BaseForm, tok.BaseReading)] {
+		return true
+	}
+	if len(k.KnownKanji) == 0 || !textproc.ContainsKanji(tok.Surface) {
+		return false
+	}
+	for _, r := range tok.Surface {
+		if textproc.IsKanji(r) && !k.KnownKanji[r] {
+			return false
+		}
+	}
+	return true
+}
+
+// Align splits a word into segments so that readings sit over the kanji they
+// belong to and okurigana is left bare: 食べる/たべる becomes 食[た]べる. Runs of
+// consecutive kanji share one reading, since splitting them further needs
+// per-kanji readings. If the reading cannot be aligned the whole word gets it.
+func Align(surface, reading string) []Segment {
+	if reading == "" || !textproc.ContainsKanji(surface) {
+		return []Segment{{Text: surface}}
+	}
+
+	groups := splitGroups(surface)
+	readings := make([]string, len(groups))
+	if !match(groups, 0, []rune(textproc.ToHiragana(reading)), readings) {
+		return []Segment{{Text: surface, Reading: reading}}
+	}
+
+	segments := make([]Segment, 0, len(groups))
+	for i, g := range groups {
+		seg := Segment{Text: g.text}
+		if g.kanji {
+			seg.Reading = readings[i]
+		}
+		segments = append(segments, seg)
+	}
+	return segments
+}
+
+type group struct {
+	text  string
+	kanji bool
+}
+
+// splitGroups splits a word into alternating runs of kanji and non-kanji
+func splitGroups(s string) []group {
+	var groups []group
+	for _, r := range s {
+		k := textproc.IsKanji(r)
+		if n := len(groups); n > 0 && groups[n-1].kanji == k {
+			groups[n-1].text += string(r)
+			continue
+		}
+		groups = append(groups, group{text: string(r), kanji: k})
+	}
+	return groups
+}
+
+// match assigns a slice of reading to every group. Kana groups must appear
+// verbatim in the reading; kanji groups take the shortest non-empty span that
+// lets the rest of the word match.
+func match(groups []group, i int, reading []rune, out []string) bool {
+	if i == len(groups) {
+		return len(reading) == 0
+	}
+	g := groups[i]
+	if !g.kanji {
+		kana := []rune(textproc.ToHiragana(g.text))
+		if len(kana) > len(reading) || string(reading[:len(kana)]) != string(kana) {
+			return false
+		}
+		return match(groups, i+1, reading[len(kana):], out)
+	}
+
+	if i == len(groups)-1 {
+		if len(reading) == 0 {
+			return false
+		}
+		out[i] = string(reading)
+		return true
+	}
+	for n := 1; n <= len(reading); n++ {
+		if match(groups, i+1, reading[n:], out) {
+			out[i] = string(reading[:n])
+			return true
+		}
+	}
+	return false
+}
+
+// Generate builds furigana segments for text[start:end]. Author-provided ruby
+// takes priority: tokens overlapping a ruby span are not given generated
+// readings. When knowledge is given, words the reader knows are left bare,
+// and author ruby is dropped if every word under it is known. Offsets of
+// tokens and ruby are rune offsets into text.
+func Generate(text []rune, start, end int, tokens []tokenizer.Token, ruby []Ruby, knowledge *Knowledge) []Segment {
+	ruby = append([]Ruby(nil), ruby...)
+	sort.Slice(ruby, func(i, j int) bool { return ruby[i].Start < ruby[j].Start })
+	// Overlapping author ruby is malformed; the first span wins
+	kept := ruby[:0]
+	for _, r := range ruby {
+		if n := len(kept); n == 0 || kept[n-1].End <= r.Start {
+			kept = append(kept, r)
+		}
+	}
+	ruby = kept
+
+	var segments []Segment
+	appendPlain := func(from, to int) {
+		if from >= to {
+			return
+		}
+		if n := len(segments); n > 0 && segments[n-1].Reading == "" && segments[n-1].End == from {
+			segments[n-1].Text += string(text[from:to])
+			segments[n-1].End = to
+			return
+		}
+		segments = append(segments, Segment{Text: string(text[from:to]), Start: from, End: to})
+	}
+
+	overlapsRuby := func(from, to int) bool {
+		i := sort.Search(len(ruby), func(i int) bool { return ruby[i].Start >= to })
+		return i > 0 && ruby[i-1].End > from
+	}
+
+	pos, ti, ri := start, 0, 0
+	for pos < end {
+		for ri < len(ruby) && ruby[ri].End <= pos {
+			ri++
+		}
+		for ti < len(tokens) && tokens[ti].End <= pos {
+			ti++
+		}
+
+		// Author ruby starting here wins over anything generated
+		if ri < len(ruby) && ruby[ri].Start <= pos {
+			r := ruby[ri]
+			to := min(r.End, end)
+			if r.Start == pos && r.End <= end && !knownSpan(tokens, ti, r, knowledge) {
+				segments = append(segments, Segment{
+					Text:    string(text[r.Start:r.End]),
+					Reading: r.Reading,
+					Source:  SourceAuthor,
+					Start:   r.Start,
+					End:     r.End,
+				})
+			} else {
+				appendPlain(pos, to)
+			}
+			pos = to
+			continue
+		}
+
+		next := end
+		if ri < len(ruby) && ruby[ri].Start < next {
+			next = ruby[ri].Start
+		}
+
+		if ti < len(tokens) && tokens[ti].Start <= pos {
+			tok := tokens[ti]
+			to := min(tok.End, end)
+			if tok.Start < pos || to != tok.End || overlapsRuby(tok.Start, tok.End) {
+				appendPlain(pos, min(to, next))
+				pos = min(to, next)
+				continue
+			}
+			offset := tok.Start
+			for _, seg := range Align(tok.Surface, tok.Reading) {
+				n := len([]rune(seg.Text))
+				if seg.Reading == "" || knowledge.Hides(tok) {
+					appendPlain(offset, offset+n)
+				} else {
+					seg.Source = SourceGenerated
+					seg.Start, seg.End = offset, offset+n
+					segments = append(segments, seg)
+				}
+				offset += n
+			}
+			pos = to
+			continue
+		}
+
+		if ti < len(tokens) && tokens[ti].Start < next {
+			next = tokens[ti].Start
+		}
+		appendPlain(pos, next)
+		pos = next
+	}
+	return segments
+}
+
+// knownSpan reports whether every word overlapping a ruby span is known.
+// Tokens before index from have already been passed and cannot overlap.
+func knownSpan(tokens []tokenizer.Token, from int, r Ruby, knowledge *Knowledge) bool {
+	if knowledge == nil {
+		return false
+	}
+	words := 0
+	for i := from; i < len(tokens) && tokens[i].Start < r.End; i++ {
+		tok := tokens[i]
+		if tok.End <= r.Start || !tok.IsWord() {
+			continue
+		}
+		if !knowledge.Hides(tok) {
+			return false
+		}
+		words++
+	}
+	return words > 0
+}
@@ -0,0 +1,224 @@
+package handlers
+
+import (
+	"html"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"japanese-learning-app/internal/anki"
+	"japanese-learning-app/internal/cards"
+	"japanese-learning-app/internal/middleware"
+	"japanese-learning-app/internal/models"
+	"japanese-learning-app/internal/srs"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ExportAnki downloads the user's cards, or those of deck_id, as an Anki
+// package (.apkg). Each word becomes a note with the sentence, word, reading,
+// definition, source and audio, and its cards keep their scheduling; with
+// history=true the review history is included as well.
+func (h *Handler) ExportAnki(c *gin.Context) {
+	user, err := middleware.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "User not found",
+		})
+		return
+	}
+
+	query := h.db.Preload("Word").Where("user_id = ?", user.ID)
+	filename := "japanese-learning"
+	if raw := c.Query("deck_id"); raw != "" {
+		id, err := strconv.ParseUint(raw, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid deck ID",
+			})
+			return
+		}
+		deckID := uint(id)
+		deck, ok := h.loadDeck(c, user.ID, &deckID)
+		if !ok {
+			return
+		}
+		// A normal deck's cards include those a filtered deck borrowed
+		if deck.IsFiltered {
+			query = query.Where("deck_id = ?", deck.ID)
+		} else {
+			query = query.Where("(deck_id = ? OR original_deck_id = ?)", deck.ID, deck.ID)
+		}
+		filename = deck.Name
+	}
+	history := c.Query("history") == "true"
+
+	var userCards []models.SRSCard
+	if err := query.Order("id").Find(&userCards).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to fetch cards",
+		})
+		return
+	}
+	if len(userCards) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "No cards to export",
+		})
+		return
+	}
+
+	var decks []models.Deck
+	if err := h.db.Where("user_id = ?", user.ID).Find(&decks).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to fetch decks",
+		})
+		return
+	}
+	reviews := make(map[uint][]models.ReviewHistory)
+	if history {
+		ids := make([]uint, len(userCards))
+		for i := range userCards {
+			ids[i] = userCards[i].ID
+		}
+		for start := 0; start < len(ids); start += exportBatchSize {
+			var batch []models.ReviewHistory
+			err := h.db.Where("user_id = ? AND card_id IN ?", user.ID, ids[start:min(start+exportBatchSize, len(ids))]).
+				Order("reviewed_at").Order("id").Find(&batch).Error
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"error": "Failed to fetch review history",
+				})
+				return
+			}
+			for _, r := range batch {
+				reviews[r.CardID] = append(reviews[r.CardID], r)
+			}
+		}
+	}
+
+	path, err := exportAnkiFile(exportNotes(userCards, decks, reviews), anki.ExportOptions{
+		Study:          srs.UserStudySettings(user),
+		Leech:          srs.UserLeechSettings(user),
+		IncludeHistory: history,
+		MediaDir:       h.mediaDir,
+		MediaPrefix:    mediaPrefix(user.ID),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to export cards",
+		})
+		return
+	}
+	defer os.Remove(path)
+
+	c.FileAttachment(path, exportFilename(filename)+".apkg")
+}
+
+// exportBatchSize bounds the card IDs whose history is fetched at once
+const exportBatchSize = 500
+
+// exportAnkiFile writes the package to a temporary file, which the caller
+// removes
+func exportAnkiFile(notes []anki.ExportNote, opts anki.ExportOptions) (string, error) {
+	f, err := os.CreateTemp("", "anki-export-*.apkg")
+	if err != nil {
+		return "", err
+	}
+	err = anki.Export(f, notes, opts, time.Now())
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// exportNotes gathers the cards of each word into a note, taking its fields
+// from the cards' content
+func exportNotes(userCards []models.SRSCard, decks []models.Deck, reviews map[uint][]models.ReviewHistory) []anki.ExportNote {
+	// Cards of the default deck go to Anki's default deck
+	deckNames := make(map[uint]string, len(decks))
+	for _, d := range decks {
+		if !d.IsDefault {
+			deckNames[d.ID] = d.Name
+		}
+	}
+
+	var notes []anki.ExportNote
+	index := make(map[uint]int)
+	for i := range userCards {
+		card := &userCards[i]
+		n, ok := index[card.WordID]
+		if !ok {
+			n = len(notes)
+			index[card.WordID] = n
+			notes = append(notes, anki.ExportNote{
+				WordID:  card.WordID,
+				Word:    html.EscapeString(card.Word.SurfaceForm),
+				Reading: html.EscapeString(card.Word.Reading),
+			})
+		}
+		note := &notes[n]
+
+		home := cards.HomeDeckID(card)
+		deck := ""
+		if home != nil {
+			deck = deckNames[*home]
+		}
+		note.Cards = append(note.Cards, anki.ExportCard{Card: card, Deck: deck, Reviews: reviews[card.ID]})
+
+		content := cards.NoteFromCard(card)
+		if note.Definition == "" {
+			note.Definition = html.EscapeString(content.Definition)
+		}
+		// A mined sentence, with its word marked, beats an example
+		if sentence, ok := card.FrontContent["sentence_html"].(string); ok && sentence != "" {
+			note.Sentence = sentence
+		} else if content.Example != nil && note.Sentence == "" {
+			note.Sentence = html.EscapeString(content.Example.Text)
+		}
+		if source := exampleSource(card, content.Example); source != "" && note.Source == "" {
+			note.Source = html.EscapeString(source)
+		}
+		if audio, ok := card.FrontContent["audio_url"].(string); ok && note.Audio == "" {
+			note.Audio = audio
+		}
+	}
+	return notes
+}
+
+// exampleSource names the book and chapter a card's sentence is from
+func exampleSource(card *models.SRSCard, example *cards.Example) string {
+	if example == nil {
+		if m, ok := card.BackContent["source"].(map[string]interface{}); ok {
+			title, _ := m["book_title"].(string)
+			chapter, _ := m["chapter"].(string)
+			example = &cards.Example{BookTitle: title, Chapter: chapter}
+		}
+	}
+	if example == nil || example.BookTitle == "" {
+		return ""
+	}
+	if example.Chapter != "" {
+		return example.BookTitle + " – " + example.Chapter
+	}
+	return example.BookTitle
+}
+
+// exportFilename makes a deck name safe to download as a file
+func exportFilename(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\:*?"<>|`, r) || r < ' ' {
+			return '_'
+		}
+		return r
+	}, strings.TrimSpace(name))
+	if name == "" {
+		return "deck"
+	}
+	return name
+}
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"japanese-learning-app/internal/anki"
+	"japanese-learning-app/internal/middleware"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// maxAnkiImportSize bounds uploaded Anki packages, which carry their media
+const maxAnkiImportSize = 500 << 20
+
+// ImportAnki imports an Anki package (.apkg) or collection backup (.colpkg)
+// uploaded as "file". Each note becomes a word with cards of the types its
+// templates map to, keeping their intervals, ease and due dates, and the
+// review log becomes review history. Fields are picked by name unless
+// "mapping" gives them per note type as JSON, e.g.
+//
+//	{"Japanese": {"word": "Kanji", "reading": "Kana", "meaning": "English",
+//	              "card_types": ["recognition", "", "recall"]}}
+//
+// With "dry_run" the note types and their mappings are returned without
+// importing anything.
+func (h *Handler) ImportAnki(c *gin.Context) {
+	user, err := middleware.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "User not found",
+		})
+		return
+	}
+
+	mappings := map[string]anki.Mapping{}
+	if raw := c.PostForm("mapping"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &mappings); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "mapping must be a JSON object of note type names to field mappings",
+			})
+			return
+		}
+	}
+
+	path, err := saveAnkiUpload(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	defer os.Remove(path)
+
+	col, err := anki.Open(path)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Not a readable Anki package",
+		})
+		return
+	}
+	defer col.Close()
+
+	var result *anki.Result
+	if c.PostForm("dry_run") == "true" {
+		result, err = anki.Inspect(col, mappings)
+	} else {
+		err = h.db.Transaction(func(tx *gorm.DB) error {
+			result, err = anki.Import(tx, user.ID, col, mappings, time.Now())
+			return err
+		})
+	}
+	var mappingErr *anki.MappingError
+	switch {
+	case errors.As(err, &mappingErr):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": mappingErr.Error(),
+		})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to import Anki package",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// saveAnkiUpload writes the uploaded package to a temporary file, which the
+// caller removes
+func saveAnkiUpload(c *gin.Context) (string, error) {
+	header, err := c.FormFile("file")
+	if err != nil {
+		return "", errors.New("no file uploaded")
+	}
+	ext := strings.ToLower(filepath.Ext(header.Filename))
+	if ext != ".apkg" && ext != ".colpkg" {
+		return "", errors.New("file must be an .apkg or .colpkg package")
+	}
+	if header.Size > maxAnkiImportSize {
+		return "", fmt.Errorf("file is larger than %d MB", maxAnkiImportSize>>20)
+	}
+
+	src, err := header.Open()
+	if err != nil {
+		return "", errors.New("failed to read uploaded file")
+	}
+	defer src.Close()
+	dst, err := os.CreateTemp("", "anki-*"+ext)
+	if err != nil {
+		return "", errors.New("failed to read uploaded file")
+	}
+	defer dst.Close()
+	if _, err := io.Copy(dst, io.LimitReader(src, maxAnkiImportSize)); err != nil {
+		os.Remove(dst.Name())
+		return "", errors.New("failed to read uploaded file")
+	}
+	return dst.Name(), nil
+}
@@ -0,0 +1,574 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"japanese-learning-app/internal/anki"
+	"japanese-learning-app/internal/cards"
+	"japanese-learning-app/internal/knowledge"
+	"japanese-learning-app/internal/middleware"
+	"japanese-learning-app/internal/models"
+	"japanese-learning-app/internal/textproc"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ankiConnectVersion is the version of the AnkiConnect protocol spoken
+const ankiConnectVersion = 6
+
+// maxAnkiConnectBody bounds a request, which may carry a media file
+const maxAnkiConnectBody = 32 << 20
+
+// maxAnkiConnectMedia bounds the media files a user can store
+const maxAnkiConnectMedia = 256 << 20
+
+// Errors worded as AnkiConnect words them, since clients show them as is
+var (
+	errAnkiConnectKey       = errors.New("valid api key must be provided")
+	errAnkiConnectAction    = errors.New("unsupported action")
+	errAnkiConnectEmpty     = errors.New("cannot create note because it is empty")
+	errAnkiConnectDuplicate = errors.New("cannot create note because it is a duplicate")
+	errAnkiConnectTooLong   = errors.New("cannot create note because its word is too long")
+)
+
+// ankiConnectRequest is a call in the AnkiConnect protocol
+type ankiConnectRequest struct {
+	Action  string          `json:"action"`
+	Version int             `json:"version"`
+	Params  json.RawMessage `json:"params"`
+	Key     string          `json:"key"`
+}
+
+// ankiConnectNote is a note to add, with fields of the exported note type
+type ankiConnectNote struct {
+	DeckName  string            `json:"deckName"`
+	ModelName string            `json:"modelName"`
+	Fields    map[string]string `json:"fields"`
+	Tags      []string          `json:"tags"`
+}
+
+// CreateAPIKey makes a new API key for the user's AnkiConnect clients,
+// replacing any earlier one. The key is only shown this once.
+func (h *Handler) CreateAPIKey(c *gin.Context) {
+	user, err := middleware.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "User not found",
+		})
+		return
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to create API key",
+		})
+		return
+	}
+	key := hex.EncodeToString(raw)
+	hash := apiKeyHash(key)
+	if err := h.db.Model(user).Update("api_key_hash", hash).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to create API key",
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"api_key": key,
+	})
+}
+
+// DeleteAPIKey revokes the user's API key
+func (h *Handler) DeleteAPIKey(c *gin.Context) {
+	user, err := middleware.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "User not found",
+		})
+		return
+	}
+
+	if err := h.db.Model(user).Update("api_key_hash", nil).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to revoke API key",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "API key revoked",
+	})
+}
+
+// apiKeyHash is what is stored of an API key
+func apiKeyHash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// AnkiConnect speaks the AnkiConnect protocol, so that popup dictionaries
+// such as Yomitan can add cards while the user reads elsewhere. Calls carry
+// the user's API key as "key"; notes use the note type of Anki exports.
+// Like AnkiConnect it always answers 200, with any error in the body.
+func (h *Handler) AnkiConnect(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxAnkiConnectBody)
+	var req ankiConnectRequest
+	if err := json.NewDecoder(c.Request.Body).Decode(&req); err != nil {
+		ankiConnectReply(c, ankiConnectVersion, nil, errors.New("failed to parse request"))
+		return
+	}
+	if req.Version == 0 {
+		req.Version = 4
+	}
+
+	// Clients ask for permission before they have a key
+	if req.Action == "requestPermission" {
+		ankiConnectReply(c, req.Version, gin.H{
+			"permission":    "granted",
+			"requireApikey": true,
+			"version":       ankiConnectVersion,
+		}, nil)
+		return
+	}
+
+	var user models.User
+	err := h.db.Where("api_key_hash = ? AND is_active = ?", apiKeyHash(req.Key), true).First(&user).Error
+	if req.Key == "" || err != nil {
+		ankiConnectReply(c, req.Version, nil, errAnkiConnectKey)
+		return
+	}
+
+	result, err := h.ankiConnectAction(c, &user, req.Action, req.Version, req.Params)
+	ankiConnectReply(c, req.Version, result, err)
+}
+
+// ankiConnectReply answers in the form of the client's protocol version:
+// from version 5 always {result, error}, before that the bare result
+func ankiConnectReply(c *gin.Context, version int, result interface{}, err error) {
+	c.JSON(http.StatusOK, ankiConnectValue(version, result, err))
+}
+
+// ankiConnectValue is the answer to one action
+func ankiConnectValue(version int, result interface{}, err error) interface{} {
+	if err != nil {
+		return gin.H{"result": nil, "error": err.Error()}
+	}
+	if version <= 4 {
+		return result
+	}
+	return gin.H{"result": result, "error": nil}
+}
+
+// ankiConnectAction runs one action. guiBrowse is a stub that only finds
+// the notes, there being no browser to open.
+func (h *Handler) ankiConnectAction(c *gin.Context, user *models.User, action string, version int, raw json.RawMessage) (interface{}, error) {
+	var params struct {
+		Note      ankiConnectNote   `json:"note"`
+		Notes     []ankiConnectNote `json:"notes"`
+		Query     string            `json:"query"`
+		ModelName string            `json:"modelName"`
+		Filename  string            `json:"filename"`
+		Data      string            `json:"data"`
+		Actions   []struct {
+			Action  string          `json:"action"`
+			Version int             `json:"version"`
+			Params  json.RawMessage `json:"params"`
+		} `json:"actions"`
+	}
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &params); err != nil {
+			return nil, errors.New("failed to parse params")
+		}
+	}
+
+	switch action {
+	case "version":
+		return ankiConnectVersion, nil
+	case "deckNames":
+		decks, err := h.ankiConnectDecks(user.ID)
+		if err != nil {
+			return nil, err
+		}
+		names := make([]string, len(decks))
+		for i, d := range decks {
+			names[i] = d.Name
+		}
+		return names, nil
+	case "deckNamesAndIds":
+		decks, err := h.ankiConnectDecks(user.ID)
+		if err != nil {
+			return nil, err
+		}
+		ids := make(map[string]uint, len(decks))
+		for _, d := range decks {
+			ids[d.Name] = d.ID
+		}
+		return ids, nil
+	case "modelNames":
+		return []string{anki.ExportNoteType}, nil
+	case "modelFieldNames":
+		if params.ModelName != anki.ExportNoteType {
+			return nil, fmt.Errorf("model was not found: %s", params.ModelName)
+		}
+		return anki.ExportFields, nil
+	case "addNote":
+		return h.addAnkiConnectNote(c, user, &params.Note)
+	case "addNotes":
+		ids := make([]*uint, len(params.Notes))
+		for i := range params.Notes {
+			if id, err := h.addAnkiConnectNote(c, user, &params.Notes[i]); err == nil {
+				ids[i] = &id
+			}
+		}
+		return ids, nil
+	case "canAddNotes":
+		can := make([]bool, len(params.Notes))
+		for i := range params.Notes {
+			_, _, err := h.checkAnkiConnectNote(user.ID, &params.Notes[i])
+			can[i] = err == nil
+		}
+		return can, nil
+	case "canAddNotesWithErrorDetail":
+		can := make([]gin.H, len(params.Notes))
+		for i := range params.Notes {
+			if _, _, err := h.checkAnkiConnectNote(user.ID, &params.Notes[i]); err != nil {
+				can[i] = gin.H{"canAdd": false, "error": err.Error()}
+			} else {
+				can[i] = gin.H{"canAdd": true}
+			}
+		}
+		return can, nil
+	case "findNotes", "guiBrowse":
+		return h.findAnkiConnectNotes(user.ID, params.Query)
+	case "storeMediaFile":
+		return h.storeAnkiConnectMedia(user.ID, params.Filename, params.Data)
+	case "multi":
+		results := make([]interface{}, len(params.Actions))
+		for i, a := range params.Actions {
+			v := a.Version
+			if v == 0 {
+				v = version
+			}
+			if a.Action == "multi" {
+				results[i] = ankiConnectValue(v, nil, errAnkiConnectAction)
+				continue
+			}
+			result, err := h.ankiConnectAction(c, user, a.Action, v, a.Params)
+			results[i] = ankiConnectValue(v, result, err)
+		}
+		return results, nil
+	}
+	return nil, errAnkiConnectAction
+}
+
+// ankiConnectDecks lists the decks notes can be added to
+func (h *Handler) ankiConnectDecks(userID uint) ([]models.Deck, error) {
+	if _, err := cards.DefaultDeck(h.db, userID); err != nil {
+		return nil, err
+	}
+	var decks []models.Deck
+	err := h.db.Where("user_id = ? AND is_filtered = ?", userID, false).
+		Order("is_default DESC").Order("name").Find(&decks).Error
+	return decks, err
+}
+
+// checkAnkiConnectNote finds the deck and word of a note, failing if the
+// user already has the word in their cards
+func (h *Handler) checkAnkiConnectNote(userID uint, note *ankiConnectNote) (*models.Deck, models.WordRef, error) {
+	var ref models.WordRef
+	if note.ModelName != anki.ExportNoteType {
+		return nil, ref, fmt.Errorf("model was not found: %s", note.ModelName)
+	}
+	var deck models.Deck
+	err := h.db.Where("user_id = ? AND name = ? AND is_filtered = ?", userID, note.DeckName, false).First(&deck).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, ref, fmt.Errorf("deck was not found: %s", note.DeckName)
+	}
+	if err != nil {
+		return nil, ref, err
+	}
+
+	ref.Word, ref.Reading = knowledge.AnkiWord(note.Fields["Word"])
+	if r := knowledge.AnkiText(note.Fields["Reading"]); r != "" {
+		ref.Reading = r
+	}
+	if ref.Word == "" {
+		return nil, ref, errAnkiConnectEmpty
+	}
+	if !anki.WordFits(ref) {
+		return nil, ref, errAnkiConnectTooLong
+	}
+
+	// Stored readings are hiragana, as in knowledge.Resolve
+	reading := textproc.ToHiragana(textproc.NormalizeString(ref.Reading))
+	var existing int64
+	err = h.db.Model(&models.SRSCard{}).
+		Joins("JOIN words ON words.id = srs_cards.word_id").
+		Where("srs_cards.user_id = ? AND words.surface_form = ?", userID, textproc.NormalizeString(ref.Word)).
+		Where("words.reading = ? OR ? = ''", reading, reading).
+		Count(&existing).Error
+	if err != nil {
+		return nil, ref, err
+	}
+	if existing > 0 {
+		return nil, ref, errAnkiConnectDuplicate
+	}
+	return &deck, ref, nil
+}
+
+// addAnkiConnectNote adds a note's word to its deck, with a card of each type
+// the deck has turned on, and returns the word's ID as the note ID
+func (h *Handler) addAnkiConnectNote(c *gin.Context, user *models.User, note *ankiConnectNote) (uint, error) {
+	deck, ref, err := h.checkAnkiConnectNote(user.ID, note)
+	if err != nil {
+		return 0, err
+	}
+
+	var word *models.Word
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		words, _, err := anki.FindWords(tx, []models.WordRef{ref})
+		if err != nil {
+			return err
+		}
+		word = words[0]
+		return nil
+	})
+	if err != nil || word == nil {
+		return 0, errors.New("failed to add word")
+	}
+
+	content := cards.Note{Word: word, Definition: ankiConnectText(note.Fields["Definition"])}
+	if content.Definition == "" {
+		content.Definition = h.cardDefinition(c.Request.Context(), word)
+	}
+	if sentence := knowledge.AnkiText(note.Fields["Sentence"]); sentence != "" {
+		content.Example = &cards.Example{Text: sentence, BookTitle: knowledge.AnkiText(note.Fields["Source"])}
+	}
+	// Only the user's own stored files can be referenced
+	audio := ""
+	if m := ankiSoundTag.FindStringSubmatch(note.Fields["Audio"]); m != nil &&
+		strings.HasPrefix(m[1], mediaPrefix(user.ID)) && filepath.Base(m[1]) == m[1] {
+		audio = m[1]
+	}
+
+	now := time.Now()
+	created := 0
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		for _, cardType := range deck.CardTypes {
+			card := cards.New(user.ID, deck.ID, cardType, content, now)
+			if audio != "" {
+				card.FrontContent["audio_url"] = audio
+			}
+			ok, err := cards.Insert(tx, &card)
+			if err != nil {
+				return err
+			}
+			if ok {
+				created++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, errors.New("failed to create cards")
+	}
+	if created == 0 {
+		return 0, errAnkiConnectDuplicate
+	}
+	return word.ID, nil
+}
+
+// ankiSoundTag matches an Anki sound tag, [sound:file.mp3]
+var ankiSoundTag = regexp.MustCompile(`\[sound:([^\]]+)\]`)
+
+// ankiBlockTag matches HTML tags that end a line
+var ankiBlockTag = regexp.MustCompile(`(?i)<br\s*/?>|</(li|div|p|tr)>`)
+
+// ankiConnectText reads a field's HTML as text, its lines, such as the items
+// of a dictionary's list of senses, joined with semicolons
+func ankiConnectText(s string) string {
+	var lines []string
+	for _, line := range strings.Split(ankiBlockTag.ReplaceAllString(s, "\n"), "\n") {
+		if line = knowledge.AnkiText(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "; ")
+}
+
+// Note fields findNotes can search, and whether they hold the reading
+var ankiConnectSearchFields = map[string]bool{
+	"word": false, "expression": false, "reading": true,
+}
+
+// findAnkiConnectNotes finds the words, as note IDs, that the user has cards
+// of matching an Anki search. Terms other than deck:, nid:, the Word and
+// Reading fields and plain text are ignored.
+func (h *Handler) findAnkiConnectNotes(userID uint, query string) ([]uint, error) {
+	q := h.db.Model(&models.SRSCard{}).Where("srs_cards.user_id = ?", userID)
+	for _, term := range searchTerms(query) {
+		key, value, found := strings.Cut(term, ":")
+		if !found {
+			key, value = "word", term
+		}
+		key = strings.ToLower(key)
+		value = strings.TrimSpace(value)
+		switch {
+		case key == "deck":
+			if value == "*" {
+				continue
+			}
+			decks := h.db.Model(&models.Deck{}).Select("id").Where("user_id = ? AND name = ?", userID, value)
+			q = q.Where("(srs_cards.deck_id IN (?) OR srs_cards.original_deck_id IN (?))", decks, decks)
+		case key == "nid":
+			var ids []uint
+			for _, s := range strings.Split(value, ",") {
+				if id, err := strconv.ParseUint(strings.TrimSpace(s), 10, 32); err == nil {
+					ids = append(ids, uint(id))
+				}
+			}
+			q = q.Where("srs_cards.word_id IN ?", ids)
+		default:
+			isReading, ok := ankiConnectSearchFields[key]
+			if !ok {
+				continue
+			}
+			column := "surface_form"
+			if isReading {
+				column = "reading"
+			}
+			word, _ := knowledge.AnkiWord(value)
+			q = q.Where("srs_cards.word_id IN (?)", h.db.Model(&models.Word{}).Select("id").
+				Where(column+" = ?", textproc.NormalizeString(word)))
+		}
+	}
+
+	ids := []uint{}
+	err := q.Distinct("srs_cards.word_id").Order("srs_cards.word_id").Pluck("srs_cards.word_id", &ids).Error
+	return ids, err
+}
+
+// searchTerms splits an Anki search into its terms, keeping quoted ones
+// whole
+func searchTerms(query string) []string {
+	var terms []string
+	var term strings.Builder
+	quoted := false
+	for _, r := range query {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case r == ' ' && !quoted:
+			if term.Len() > 0 {
+				terms = append(terms, term.String())
+				term.Reset()
+			}
+		default:
+			term.WriteRune(r)
+		}
+	}
+	if term.Len() > 0 {
+		terms = append(terms, term.String())
+	}
+	return slices.DeleteFunc(terms, func(t string) bool {
+		// Negated terms would need the whole search language
+		return strings.HasPrefix(t, "-")
+	})
+}
+
+// storeAnkiConnectMedia saves a base64 media file, such as a word's audio,
+// to the media directory and returns the name it was saved as. Names are
+// prefixed with the user's ID so users cannot overwrite each other's files,
+// and a user's files together are kept under maxAnkiConnectMedia.
+func (h *Handler) storeAnkiConnectMedia(userID uint, filename, data string) (string, error) {
+	if h.mediaDir == "" {
+		return "", errors.New("media files are not supported")
+	}
+	name := filepath.Base(filepath.Clean("/" + filename))
+	if name == "/" || name == "." || strings.HasPrefix(name, ".") {
+		return "", errors.New("invalid file name")
+	}
+	content, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return "", errors.New("media data must be base64")
+	}
+
+	prefix := mediaPrefix(userID)
+	name = prefix + strings.TrimPrefix(name, prefix)
+	path := filepath.Join(h.mediaDir, name)
+
+	// Stores are serialized so the limit holds for concurrent requests
+	h.mediaMu.Lock()
+	defer h.mediaMu.Unlock()
+	used, err := h.mediaUsage(userID)
+	if err != nil {
+		return "", errors.New("failed to store media file")
+	}
+	var replaced int64
+	if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+		replaced = info.Size()
+	}
+	if used-replaced+int64(len(content)) > maxAnkiConnectMedia {
+		return "", errors.New("media storage limit reached")
+	}
+	if err := os.WriteFile(path, content, 0o644); err != nil {
+		// The file may be partly written; count it afresh next time
+		delete(h.mediaUsed, userID)
+		return "", errors.New("failed to store media file")
+	}
+	h.mediaUsed[userID] = used - replaced + int64(len(content))
+	return name, nil
+}
+
+// mediaPrefix starts the names of a user's media files
+func mediaPrefix(userID uint) string {
+	return fmt.Sprintf("%d_", userID)
+}
+
+// mediaUsage returns the total size of the user's media files, counting
+// them on first use. The caller holds mediaMu.
+func (h *Handler) mediaUsage(userID uint) (int64, error) {
+	if used, ok := h.mediaUsed[userID]; ok {
+		return used, nil
+	}
+	if err := os.MkdirAll(h.mediaDir, 0o755); err != nil {
+		return 0, err
+	}
+	entries, err := os.ReadDir(h.mediaDir)
+	if err != nil {
+		return 0, err
+	}
+	prefix := mediaPrefix(userID)
+	var total int64
+	for _, e := range entries {
+		if !e.Type().IsRegular() || !strings.HasPrefix(e.Name(), prefix) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		total += info.Size()
+	}
+	if h.mediaUsed == nil {
+		h.mediaUsed = make(map[uint]int64)
+	}
+	h.mediaUsed[userID] = total
+	return total, nil
+}
@@ -0,0 +1,243 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"japanese-learning-app/internal/cards"
+	"japanese-learning-app/internal/middleware"
+	"japanese-learning-app/internal/models"
+	"japanese-learning-app/internal/srs"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// CardAction suspends, unsuspends, buries, unburies, forgets, resets,
+// reschedules or moves one of the user's cards, as named by the :action
+// path parameter. Rescheduling takes {"days": n}, moving {"deck_id": id}.
+func (h *Handler) CardAction(c *gin.Context) {
+	user, err := middleware.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "User not found",
+		})
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid card ID",
+		})
+		return
+	}
+	// The body is optional
+	var req models.CardActionRequest
+	if err := c.ShouldBindJSON(&req); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	req.CardIDs = []uint{uint(id)}
+	req.Action = c.Param("action")
+	if !h.validCardAction(c, user.ID, &req) {
+		return
+	}
+
+	updated, err := h.applyCardAction(user, &req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to update card",
+		})
+		return
+	}
+	if len(updated) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Card not found",
+		})
+		return
+	}
+
+	var card models.SRSCard
+	if err := h.db.Preload("Word").First(&card, id).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to fetch card",
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"card": card,
+	})
+}
+
+// BulkCardAction applies one action to the selected cards. Cards that are
+// not the user's are reported back as not found.
+func (h *Handler) BulkCardAction(c *gin.Context) {
+	user, err := middleware.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "User not found",
+		})
+		return
+	}
+
+	var req models.CardActionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if len(req.CardIDs) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "card_ids is required",
+		})
+		return
+	}
+	if !h.validCardAction(c, user.ID, &req) {
+		return
+	}
+
+	updated, err := h.applyCardAction(user, &req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to update cards",
+		})
+		return
+	}
+
+	found := make(map[uint]bool, len(updated))
+	for _, id := range updated {
+		found[id] = true
+	}
+	notFound := make([]uint, 0)
+	for _, id := range req.CardIDs {
+		if !found[id] {
+			notFound = append(notFound, id)
+			found[id] = true
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"action":    req.Action,
+		"updated":   len(updated),
+		"not_found": notFound,
+	})
+}
+
+// validCardAction checks the action and its arguments. On failure it writes
+// the error response and returns false.
+func (h *Handler) validCardAction(c *gin.Context, userID uint, req *models.CardActionRequest) bool {
+	switch req.Action {
+	case models.CardActionSuspend, models.CardActionUnsuspend, models.CardActionBury, models.CardActionUnbury,
+		models.CardActionForget, models.CardActionReset:
+		return true
+	case models.CardActionReschedule:
+		if req.Days == nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "days is required to reschedule",
+			})
+			return false
+		}
+		return true
+	case models.CardActionMove:
+		if req.DeckID == nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "deck_id is required to move cards",
+			})
+			return false
+		}
+		deck, ok := h.loadDeck(c, userID, req.DeckID)
+		if !ok {
+			return false
+		}
+		if deck.IsFiltered {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Cards cannot be moved to a filtered deck",
+			})
+			return false
+		}
+		return true
+	case "":
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "action is required",
+		})
+		return false
+	}
+	c.JSON(http.StatusBadRequest, gin.H{
+		"error": "Unknown action",
+	})
+	return false
+}
+
+// applyCardAction applies the request's action to those of its cards that
+// are the user's, and returns their IDs
+func (h *Handler) applyCardAction(user *models.User, req *models.CardActionRequest) ([]uint, error) {
+	var ids []uint
+	err := h.db.Model(&models.SRSCard{}).Where("user_id = ? AND id IN ?", user.ID, req.CardIDs).
+		Order("id").Pluck("id", &ids).Error
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+
+	now := time.Now()
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		selected := func() *gorm.DB {
+			return tx.Model(&models.SRSCard{}).Where("id IN ?", ids)
+		}
+		switch req.Action {
+		case models.CardActionSuspend, models.CardActionUnsuspend:
+			return selected().Update("is_suspended", req.Action == models.CardActionSuspend).Error
+		case models.CardActionBury:
+			return selected().Updates(map[string]interface{}{
+				"is_buried":    true,
+				"buried_until": srs.UserStudySettings(user).DayEnd(now),
+			}).Error
+		case models.CardActionUnbury:
+			return selected().Updates(map[string]interface{}{"is_buried": false, "buried_until": nil}).Error
+		case models.CardActionForget, models.CardActionReset:
+			updates := map[string]interface{}{
+				"state":            models.CardStateNew,
+				"learning_step":    0,
+				"ease_factor":      srs.DefaultSM2Settings.StartingEase,
+				"interval_days":    1,
+				"repetition_count": 0,
+				"stability":        0,
+				"difficulty":       0,
+				"due_date":         now,
+				"undone_at":        nil,
+			}
+			if req.Action == models.CardActionReset {
+				for _, field := range []string{"lapses", "total_reviews", "correct_reviews", "current_streak", "longest_streak"} {
+					updates[field] = 0
+				}
+				updates["is_leech"] = false
+			}
+			return selected().Updates(updates).Error
+		case models.CardActionReschedule:
+			// Cards not yet in review become review cards with the new interval
+			due := now.AddDate(0, 0, *req.Days)
+			if err := selected().Where("state = ?", models.CardStateReview).
+				Updates(map[string]interface{}{"due_date": due, "undone_at": nil}).Error; err != nil {
+				return err
+			}
+			return selected().Where("state <> ?", models.CardStateReview).Updates(map[string]interface{}{
+				"state":         models.CardStateReview,
+				"learning_step": 0,
+				"interval_days": max(*req.Days, 1),
+				"due_date":      due,
+				"undone_at":     nil,
+			}).Error
+		case models.CardActionMove:
+			return cards.Move(tx, ids, *req.DeckID)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"net/http"
+
+	"japanese-learning-app/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// hardChapterMargin is how many points above the book's own difficulty
+// score a chapter has to be before it is flagged as hard
+const hardChapterMargin = 10
+
+// ChapterResponse is a chapter with its profile and a warning flag
+type ChapterResponse struct {
+	models.Chapter
+	HarderThanBook bool `json:"harder_than_book"`
+}
+
+// GetBookChapters returns the book's chapters along with their difficulty
+// and vocabulary profiles. Profiles are filled in when the book is analyzed.
+func (h *Handler) GetBookChapters(c *gin.Context) {
+	_, book, ok := h.loadUserBook(c)
+	if !ok {
+		return
+	}
+
+	chapters := book.Chapters()
+	response := make([]ChapterResponse, 0, len(chapters))
+	for _, chapter := range chapters {
+		r := ChapterResponse{Chapter: chapter}
+		if chapter.Profile != nil && book.DifficultyProfile != nil {
+			r.HarderThanBook = chapter.Profile.DifficultyScore >= book.DifficultyProfile.Score+hardChapterMargin
+		}
+		response = append(response, r)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"book_id":          book.ID,
+		"difficulty_level": book.DifficultyLevel,
+		"chapters":         response,
+	})
+}
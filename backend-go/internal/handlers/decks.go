@@ -0,0 +1,494 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"japanese-learning-app/internal/cards"
+	"japanese-learning-app/internal/middleware"
+	"japanese-learning-app/internal/models"
+	"japanese-learning-app/internal/srs"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// GetDecks lists the user's decks, the default one first
+func (h *Handler) GetDecks(c *gin.Context) {
+	user, err := middleware.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "User not found",
+		})
+		return
+	}
+
+	if _, err := cards.DefaultDeck(h.db, user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to fetch decks",
+		})
+		return
+	}
+	var decks []models.Deck
+	if err := h.db.Where("user_id = ?", user.ID).Order("is_default DESC").Order("is_filtered").Order("name").Find(&decks).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to fetch decks",
+		})
+		return
+	}
+	ptrs := make([]*models.Deck, len(decks))
+	for i := range decks {
+		ptrs[i] = &decks[i]
+	}
+	if err := h.countDeckCards(user.ID, ptrs...); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to fetch decks",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"decks": decks,
+	})
+}
+
+// CreateDeck creates a deck. A filtered deck borrows the cards its filter
+// selects at once; with move_cards the matching cards are moved into the
+// new deck instead.
+func (h *Handler) CreateDeck(c *gin.Context) {
+	user, err := middleware.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "User not found",
+		})
+		return
+	}
+
+	var req models.CreateDeckRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if req.Filter != nil && req.MoveCards != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "A filtered deck cannot take cards with move_cards",
+		})
+		return
+	}
+	if req.Filter != nil && !h.validFilter(c, user.ID, req.Filter) {
+		return
+	}
+	if req.MoveCards != nil && !h.validFilter(c, user.ID, req.MoveCards) {
+		return
+	}
+	// The default deck is made first so a new deck cannot take its name
+	if _, err := cards.DefaultDeck(h.db, user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to create deck",
+		})
+		return
+	}
+
+	deck := models.Deck{
+		UserID:       user.ID,
+		Name:         strings.TrimSpace(req.Name),
+		CardTypes:    uniqueStrings(req.CardTypes),
+		BurySiblings: req.BurySiblings == nil || *req.BurySiblings,
+		IsFiltered:   req.Filter != nil,
+		Filter:       req.Filter,
+	}
+	if deck.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Deck name is required",
+		})
+		return
+	}
+	switch {
+	case deck.IsFiltered:
+		// Cards are only ever added to their home decks
+		deck.CardTypes = []string{}
+	case len(deck.CardTypes) == 0:
+		deck.CardTypes = []string{models.CardTypeRecognition}
+	}
+
+	dayEnd := srs.UserStudySettings(user).DayEnd(time.Now())
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&deck)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errDeckNameTaken
+		}
+		if deck.IsFiltered {
+			_, err := cards.Build(tx, &deck, dayEnd)
+			return err
+		}
+		if req.MoveCards == nil {
+			return nil
+		}
+		var ids []uint
+		if err := cards.Matching(tx, user.ID, req.MoveCards, dayEnd).Pluck("srs_cards.id", &ids).Error; err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+		return cards.Move(tx, ids, deck.ID)
+	})
+	if err == errDeckNameTaken {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "A deck with this name already exists",
+		})
+		return
+	}
+	if err == nil {
+		err = h.countDeckCards(user.ID, &deck)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to create deck",
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, deck)
+}
+
+// UpdateDeck renames a deck or changes its options. Card types turned on
+// are added to the words already in the deck; turning a type off only stops
+// new cards of it. A filtered deck given a new filter is rebuilt.
+func (h *Handler) UpdateDeck(c *gin.Context) {
+	user, err := middleware.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "User not found",
+		})
+		return
+	}
+
+	var req models.UpdateDeckRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	deck, ok := h.deckParam(c, user.ID)
+	if !ok {
+		return
+	}
+
+	var added []string
+	if req.Name != nil {
+		deck.Name = strings.TrimSpace(*req.Name)
+		if deck.Name == "" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Deck name is required",
+			})
+			return
+		}
+	}
+	if req.CardTypes != nil {
+		if deck.IsFiltered {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Filtered decks have no card types",
+			})
+			return
+		}
+		types := uniqueStrings(req.CardTypes)
+		for _, t := range types {
+			if !slices.Contains(deck.CardTypes, t) {
+				added = append(added, t)
+			}
+		}
+		deck.CardTypes = types
+	}
+	if req.BurySiblings != nil {
+		deck.BurySiblings = *req.BurySiblings
+	}
+	if req.Filter != nil {
+		if !deck.IsFiltered {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Only filtered decks have a filter",
+			})
+			return
+		}
+		if !h.validFilter(c, user.ID, req.Filter) {
+			return
+		}
+		deck.Filter = req.Filter
+	}
+
+	var taken int64
+	if err := h.db.Model(&models.Deck{}).Where("user_id = ? AND name = ? AND id <> ?", user.ID, deck.Name, deck.ID).Count(&taken).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to update deck",
+		})
+		return
+	}
+	if taken > 0 {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "A deck with this name already exists",
+		})
+		return
+	}
+
+	created := 0
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(deck).Error; err != nil {
+			return err
+		}
+		if req.Filter != nil {
+			_, err := cards.Build(tx, deck, srs.UserStudySettings(user).DayEnd(time.Now()))
+			return err
+		}
+		var err error
+		created, err = cards.AddMissingTypes(tx, deck, added)
+		return err
+	})
+	if err == nil {
+		err = h.countDeckCards(user.ID, deck)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to update deck",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"deck":          deck,
+		"cards_created": created,
+	})
+}
+
+// RebuildDeck hands back a filtered deck's cards and takes the cards its
+// filter selects now
+func (h *Handler) RebuildDeck(c *gin.Context) {
+	h.refillDeck(c, true)
+}
+
+// EmptyDeck hands all of a filtered deck's cards back to their home decks
+func (h *Handler) EmptyDeck(c *gin.Context) {
+	h.refillDeck(c, false)
+}
+
+// refillDeck empties a filtered deck and, if rebuild is set, builds it again
+func (h *Handler) refillDeck(c *gin.Context, rebuild bool) {
+	user, err := middleware.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "User not found",
+		})
+		return
+	}
+
+	deck, ok := h.deckParam(c, user.ID)
+	if !ok {
+		return
+	}
+	if !deck.IsFiltered {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Only filtered decks can be rebuilt or emptied",
+		})
+		return
+	}
+
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if !rebuild {
+			return cards.Empty(tx, deck)
+		}
+		_, err := cards.Build(tx, deck, srs.UserStudySettings(user).DayEnd(time.Now()))
+		return err
+	})
+	if err == nil {
+		err = h.countDeckCards(user.ID, deck)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to update deck",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, deck)
+}
+
+// DeleteDeck deletes a deck. A filtered deck's cards go back to their home
+// decks; a normal deck's cards go to the default deck.
+func (h *Handler) DeleteDeck(c *gin.Context) {
+	user, err := middleware.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "User not found",
+		})
+		return
+	}
+
+	deck, ok := h.deckParam(c, user.ID)
+	if !ok {
+		return
+	}
+	if deck.IsDefault {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "The default deck cannot be deleted",
+		})
+		return
+	}
+
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if deck.IsFiltered {
+			if err := cards.Empty(tx, deck); err != nil {
+				return err
+			}
+		} else {
+			home, err := cards.DefaultDeck(tx, user.ID)
+			if err != nil {
+				return err
+			}
+			var ids []uint
+			err = tx.Model(&models.SRSCard{}).Where("deck_id = ? OR original_deck_id = ?", deck.ID, deck.ID).
+				Pluck("id", &ids).Error
+			if err != nil {
+				return err
+			}
+			if len(ids) > 0 {
+				if err := cards.Move(tx, ids, home.ID); err != nil {
+					return err
+				}
+			}
+		}
+		return tx.Delete(deck).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to delete deck",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Deck deleted successfully",
+	})
+}
+
+// errDeckNameTaken is returned when creating a deck with a name in use
+var errDeckNameTaken = errors.New("deck name taken")
+
+// deckParam fetches the user's deck named by the :id path parameter. On
+// failure it writes the error response and returns false.
+func (h *Handler) deckParam(c *gin.Context, userID uint) (*models.Deck, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid deck ID",
+		})
+		return nil, false
+	}
+	deckID := uint(id)
+	return h.loadDeck(c, userID, &deckID)
+}
+
+// loadDeck fetches one of the user's decks, or their default deck if id is
+// nil. On failure it writes the error response and returns false.
+func (h *Handler) loadDeck(c *gin.Context, userID uint, id *uint) (*models.Deck, bool) {
+	if id == nil {
+		deck, err := cards.DefaultDeck(h.db, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to fetch deck",
+			})
+			return nil, false
+		}
+		return deck, true
+	}
+
+	var deck models.Deck
+	if err := h.db.Where("id = ? AND user_id = ?", *id, userID).First(&deck).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Deck not found",
+			})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to fetch deck",
+		})
+		return nil, false
+	}
+	return &deck, true
+}
+
+// validFilter checks that the deck and book a filter names are the user's.
+// On failure it writes the error response and returns false.
+func (h *Handler) validFilter(c *gin.Context, userID uint, filter *models.DeckFilter) bool {
+	if filter.DeckID != nil {
+		deck, ok := h.loadDeck(c, userID, filter.DeckID)
+		if !ok {
+			return false
+		}
+		if deck.IsFiltered {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "A filter cannot select cards of a filtered deck",
+			})
+			return false
+		}
+	}
+	if filter.BookID != nil {
+		var count int64
+		if err := h.db.Model(&models.Book{}).Where("id = ? AND user_id = ?", *filter.BookID, userID).Count(&count).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to fetch book",
+			})
+			return false
+		}
+		if count == 0 {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Book not found",
+			})
+			return false
+		}
+	}
+	return true
+}
+
+// countDeckCards sets the card counts of the user's decks
+func (h *Handler) countDeckCards(userID uint, decks ...*models.Deck) error {
+	var counts []struct {
+		DeckID uint
+		Count  int64
+	}
+	err := h.db.Model(&models.SRSCard{}).Select("deck_id, COUNT(*) AS count").
+		Where("user_id = ? AND deck_id IS NOT NULL", userID).Group("deck_id").Scan(&counts).Error
+	if err != nil {
+		return err
+	}
+	for _, deck := range decks {
+		deck.CardCount = 0
+		for _, row := range counts {
+			if row.DeckID == deck.ID {
+				deck.CardCount = row.Count
+			}
+		}
+	}
+	return nil
+}
+
+// uniqueStrings drops repeated values, keeping the first of each
+func uniqueStrings(values []string) []string {
+	var out []string
+	for _, v := range values {
+		if !slices.Contains(out, v) {
+			out = append(out, v)
+		}
+	}
+	return out
+}
@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"japanese-learning-app/internal/cards"
+	"japanese-learning-app/internal/middleware"
+	"japanese-learning-app/internal/models"
+	"japanese-learning-app/internal/srs"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Bounds of the forecast
+const (
+	defaultForecastDays = 30
+	maxForecastDays     = 365
+	// maxForecastWork bounds the card-days simulated for one request;
+	// larger collections get fewer simulations, then fewer days
+	maxForecastWork = 10_000_000
+
+	// Reviews looked back over for the user's retention, and how many of
+	// them are needed before it is trusted over the desired retention
+	retentionWindow     = 90 * 24 * time.Hour
+	minRetentionReviews = 50
+)
+
+// GetForecast projects the user's daily reviews over the next days (30 by
+// default) from their cards' due dates, their retention and daily limits.
+// With book_id the cards the book's new words would add are included, to
+// see what studying it would cost. Suspended and buried cards are left out,
+// and large collections are simulated fewer times.
+func (h *Handler) GetForecast(c *gin.Context) {
+	user, err := middleware.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "User not found",
+		})
+		return
+	}
+
+	days, err := strconv.Atoi(c.DefaultQuery("days", strconv.Itoa(defaultForecastDays)))
+	if err != nil || days < 1 || days > maxForecastDays {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "days must be from 1 to 365",
+		})
+		return
+	}
+
+	added := 0
+	if raw := c.Query("book_id"); raw != "" {
+		id, err := strconv.ParseUint(raw, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid book ID",
+			})
+			return
+		}
+		bookID := uint(id)
+		if !h.validFilter(c, user.ID, &models.DeckFilter{BookID: &bookID}) {
+			return
+		}
+		if added, err = h.bookCardsToAdd(user.ID, bookID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to count the book's words",
+			})
+			return
+		}
+	}
+
+	now := time.Now()
+	study := srs.UserStudySettings(user)
+	var userCards []models.SRSCard
+	err = h.db.Select("id", "state", "learning_step", "ease_factor", "interval_days", "repetition_count", "lapses", "stability", "difficulty", "due_date", "last_reviewed_at").
+		Where("user_id = ? AND is_suspended = ?", user.ID, false).
+		Where("is_buried = ? OR buried_until <= ?", false, now).
+		Find(&userCards).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to fetch cards",
+		})
+		return
+	}
+	simulated := len(userCards) + added
+	runs := min(srs.ForecastRuns, maxForecastWork/max(simulated*days, 1))
+	if runs < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("Too many cards to forecast %d days; at most %d", days, maxForecastWork/simulated),
+		})
+		return
+	}
+	retention, err := h.retention(user, now)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to fetch review history",
+		})
+		return
+	}
+	newStudied, reviewsStudied, err := h.studiedToday(user.ID, study.DayStart(now))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to fetch review history",
+		})
+		return
+	}
+
+	waiting := 0
+	for _, card := range userCards {
+		if card.State == models.CardStateNew {
+			waiting++
+		}
+	}
+	forecast := srs.Forecast(srs.ForUser(user), userCards, srs.ForecastOptions{
+		Days:           days,
+		Retention:      retention,
+		Study:          study,
+		NewStudied:     newStudied,
+		ReviewsStudied: reviewsStudied,
+		ExtraNew:       added,
+		Runs:           runs,
+	}, now)
+
+	c.JSON(http.StatusOK, gin.H{
+		"days":        forecast,
+		"retention":   retention,
+		"new_waiting": waiting,
+		"cards_added": added,
+		"limits": gin.H{
+			"new_cards_per_day":   study.NewCardsPerDay,
+			"max_reviews_per_day": study.MaxReviewsPerDay,
+		},
+	})
+}
+
+// retention is the share of the user's recent reviews that were recalled,
+// or their desired retention if they have too few reviews yet
+func (h *Handler) retention(user *models.User, now time.Time) (float64, error) {
+	var counts struct {
+		Total  int64
+		Passed int64
+	}
+	err := h.db.Model(&models.ReviewHistory{}).
+		Select("COUNT(*) AS total, COUNT(CASE WHEN response_quality > ? THEN 1 END) AS passed", int(srs.Again)).
+		Where("user_id = ? AND old_state = ? AND reviewed_at >= ?", user.ID, models.CardStateReview, now.Add(-retentionWindow)).
+		Scan(&counts).Error
+	if err != nil {
+		return 0, err
+	}
+	if counts.Total < minRetentionReviews {
+		return srs.UserFSRSParams(user).DesiredRetention, nil
+	}
+	return float64(counts.Passed) / float64(counts.Total), nil
+}
+
+// bookCardsToAdd counts the cards the default deck would get for the
+// book's words the user neither has cards for nor knows
+func (h *Handler) bookCardsToAdd(userID, bookID uint) (int, error) {
+	var words int64
+	err := h.db.Model(&models.BookWord{}).
+		Where("book_id = ?", bookID).
+		Where("word_id NOT IN (?)", h.db.Model(&models.SRSCard{}).Select("word_id").Where("user_id = ?", userID)).
+		Where("word_id NOT IN (?)", h.db.Model(&models.UserWordKnowledge{}).Select("word_id").
+			Where("user_id = ? AND (knowledge_level >= ? OR is_ignored = ?)", userID, models.KnowledgeKnown, true)).
+		Count(&words).Error
+	if err != nil {
+		return 0, err
+	}
+	deck, err := cards.DefaultDeck(h.db, userID)
+	if err != nil {
+		return 0, err
+	}
+	return int(words) * len(deck.CardTypes), nil
+}
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"net/http"
+
+	"japanese-learning-app/internal/furigana"
+	"japanese-learning-app/internal/models"
+	"japanese-learning-app/internal/textproc"
+	"japanese-learning-app/internal/tokenizer"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetChapterFurigana returns a chapter split into segments with readings.
+// Author-provided ruby is used where present; everything else is generated
+// from the tokenizer. Readings are left out for words the user knows unless
+// show_all=true is passed.
+func (h *Handler) GetChapterFurigana(c *gin.Context) {
+	user, book, ok := h.loadUserBook(c)
+	if !ok {
+		return
+	}
+	chapter, ok := loadChapter(c, book)
+	if !ok {
+		return
+	}
+
+	text := []rune(book.ExtractedText)
+	tokens := h.tokenizeRange(text, chapter.StartPos, chapter.EndPos)
+
+	var knowledge *furigana.Knowledge
+	if c.Query("show_all") != "true" {
+		var err error
+		knowledge, err = h.furiganaKnowledge(user, tokens)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to load word knowledge",
+			})
+			return
+		}
+	}
+
+	segments := furigana.Generate(text, chapter.StartPos, chapter.EndPos, tokens, rubyFor(book), knowledge)
+
+	c.JSON(http.StatusOK, gin.H{
+		"book_id":  book.ID,
+		"chapter":  chapter,
+		"segments": segments,
+	})
+}
+
+// furiganaKnowledge collects the words in tokens that the user knows well
+// enough to read without furigana, along with the kanji they have learned.
+// The knowledge level that counts as known comes from the user's
+// furigana_threshold preference; ignored words never get readings.
+func (h *Handler) furiganaKnowledge(user *models.User, tokens []tokenizer.Token) (*furigana.Knowledge, error) {
+	knowledge := &furigana.Knowledge{
+		KnownWords: make(map[string]bool),
+		KnownKanji: make(map[rune]bool),
+	}
+	for _, r := range user.PreferenceString(models.PrefKnownKanji, "") {
+		if textproc.IsKanji(r) {
+			knowledge.KnownKanji[r] = true
+		}
+	}
+
+	seen := make(map[string]bool)
+	var baseForms []string
+	for _, tok := range tokens {
+		if tok.IsWord() && !seen[tok.BaseForm] {
+			seen[tok.BaseForm] = true
+			baseForms = append(baseForms, tok.BaseForm)
+		}
+	}
+	if len(baseForms) == 0 {
+		return knowledge, nil
+	}
+
+	threshold := user.PreferenceInt(models.PrefFuriganaThreshold, models.KnowledgeKnown)
+	var known []models.Word
+	err := h.db.Model(&models.Word{}).
+		Select("words.surface_form, words.reading").
+		Joins("JOIN user_word_knowledge ON user_word_knowledge.word_id = words.id").
+		Where("user_word_knowledge.user_id = ? AND words.surface_form IN ?", user.ID, baseForms).
+		Where("user_word_knowledge.knowledge_level >= ? OR user_word_knowledge.is_ignored = ?", threshold, true).
+		Find(&known).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, w := range known {
+		knowledge.KnownWords[furigana.WordKey(w.SurfaceForm, w.Reading)] = true
+	}
+	return knowledge, nil
+}
+
+// tokenizeRange tokenizes text[start:end] with offsets relative to text
+func (h *Handler) tokenizeRange(text []rune, start, end int) []tokenizer.Token {
+	tokens := h.tokenizer.Tokenize(string(text[start:end]))
+	for i := range tokens {
+		tokens[i].Start += start
+		tokens[i].End += start
+	}
+	return tokens
+}
+
+// rubyFor converts the book's stored author ruby for furigana generation
+func rubyFor(book *models.Book) []furigana.Ruby {
+	ruby := make([]furigana.Ruby, 0, len(book.RubyData))
+	for _, r := range book.RubyData {
+		ruby = append(ruby, furigana.Ruby{Start: r.StartPos, End: r.EndPos, Reading: r.Reading})
+	}
+	return ruby
+}
@@ -1,12 +1,19 @@
 package handlers
 
 import (
+	"log"
 	"net/http"
 	"strconv"
+	"sync"
 	"time"
 
+	"japanese-learning-app/internal/dictionary"
 	"japanese-learning-app/internal/middleware"
 	"japanese-learning-app/internal/models"
+	"japanese-learning-app/internal/optimizer"
+	"japanese-learning-app/internal/processing"
+	"japanese-learning-app/internal/tokenizer"
+	"japanese-learning-app/internal/wordlist"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
@@ -14,12 +21,26 @@ import (
 
 // Handler holds the database connection and other dependencies
 type Handler struct {
-	db *gorm.DB
+	db         *gorm.DB
+	tokenizer  *tokenizer.Tokenizer
+	processor  *processing.Processor
+	dictionary *dictionary.Service
+	lists      *wordlist.Lists
+	optimizer  *optimizer.Optimizer
+	mediaDir   string // Audio files that Anki exports pack
+	mediaMu    sync.Mutex
+	mediaUsed  map[uint]int64 // Bytes of media stored per user, counted on first use
 }
 
-// New creates a new handler with the given database connection
-func New(db *gorm.DB) *Handler {
-	return &Handler{db: db}
+// New creates a new handler with the given database connection, tokenizer,
+// book processor, dictionary service, word lists and FSRS optimizer
+func New(db *gorm.DB, tok *tokenizer.Tokenizer, processor *processing.Processor, dict *dictionary.Service, lists *wordlist.Lists, opt *optimizer.Optimizer) *Handler {
+	return &Handler{db: db, tokenizer: tok, processor: processor, dictionary: dict, lists: lists, optimizer: opt}
+}
+
+// SetMediaDir sets where the audio files cards refer to are kept
+func (h *Handler) SetMediaDir(dir string) {
+	h.mediaDir = dir
 }
 
 // Register handles user registration
@@ -41,12 +62,22 @@ func (h *Handler) Register(c *gin.Context) {
 		return
 	}
 
+	if req.Timezone != "" {
+		if _, err := time.LoadLocation(req.Timezone); err != nil || req.Timezone == "Local" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Unknown timezone",
+			})
+			return
+		}
+	}
+
 	// Create new user
 	user := models.User{
 		Username:          req.Username,
 		Email:             req.Email,
 		Password:          req.Password,
 		PreferredLanguage: req.PreferredLanguage,
+		Timezone:          req.Timezone,
 	}
 
 	// Hash password
@@ -269,34 +300,48 @@ func (h *Handler) DeleteBook(c *gin.Context) {
 	})
 }
 
-// Placeholder handlers for features to be implemented
-func (h *Handler) LookupWord(c *gin.Context) {
-	word := c.Param("word")
-	c.JSON(http.StatusOK, gin.H{
-		"word":    word,
-		"message": "Word lookup not yet implemented",
-	})
-}
+// AnalyzeBook starts tokenizing a book and estimating its difficulty. The
+// work runs in the background; poll the book's processing_status.
+func (h *Handler) AnalyzeBook(c *gin.Context) {
+	_, book, ok := h.loadUserBook(c)
+	if !ok {
+		return
+	}
 
-func (h *Handler) MarkWordAsKnown(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{
-		"message": "Mark word as known not yet implemented",
-	})
-}
+	if book.ExtractedText == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Book has no extracted text",
+		})
+		return
+	}
 
-func (h *Handler) GetDueCards(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{
-		"due_cards": []interface{}{},
-		"message":   "SRS system not yet implemented",
-	})
-}
+	started, err := h.processor.Start(book.ID, time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to start processing",
+		})
+		return
+	}
+	if !started {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "Book is already being processed",
+		})
+		return
+	}
 
-func (h *Handler) ReviewCard(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{
-		"message": "SRS review not yet implemented",
+	go func(bookID uint) {
+		if err := h.processor.ProcessBook(bookID); err != nil {
+			log.Printf("Book processing failed: %v", err)
+		}
+	}(book.ID)
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":           "Book processing started",
+		"processing_status": processing.StatusProcessing,
 	})
 }
 
+// Placeholder handlers for features to be implemented
 func (h *Handler) StartReadingSession(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Reading session tracking not yet implemented",
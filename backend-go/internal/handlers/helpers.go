@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"japanese-learning-app/internal/middleware"
+	"japanese-learning-app/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// loadUserBook resolves the current user and the book named by the :id path
+// parameter. On failure the error response has already been written.
+func (h *Handler) loadUserBook(c *gin.Context) (*models.User, *models.Book, bool) {
+	user, err := middleware.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "User not found",
+		})
+		return nil, nil, false
+	}
+
+	bookID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid book ID",
+		})
+		return nil, nil, false
+	}
+
+	var book models.Book
+	if err := h.db.Where("id = ? AND user_id = ?", bookID, user.ID).First(&book).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Book not found",
+			})
+			return nil, nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to fetch book",
+		})
+		return nil, nil, false
+	}
+
+	return user, &book, true
+}
+
+// loadChapter resolves the :n path parameter to one of the book's chapters.
+// On failure the error response has already been written.
+func loadChapter(c *gin.Context, book *models.Book) (models.Chapter, bool) {
+	return chapterByIndex(c, book, c.Param("n"))
+}
+
+// chapterByIndex resolves a chapter index given as a string. On failure the
+// error response has already been written.
+func chapterByIndex(c *gin.Context, book *models.Book, raw string) (models.Chapter, bool) {
+	chapters := book.Chapters()
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 0 || n >= len(chapters) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Chapter not found",
+		})
+		return models.Chapter{}, false
+	}
+	return chapters[n], true
+}
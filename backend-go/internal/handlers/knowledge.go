@@ -0,0 +1,227 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"japanese-learning-app/internal/knowledge"
+	"japanese-learning-app/internal/middleware"
+	"japanese-learning-app/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// errBookNotFound is returned when a request names a book the user does not own
+var errBookNotFound = errors.New("book not found")
+
+// MarkWordAsKnown sets the user's knowledge level for one word, known by
+// default. Words given by form and reading that are not in the dictionary
+// yet are added.
+func (h *Handler) MarkWordAsKnown(c *gin.Context) {
+	user, err := middleware.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "User not found",
+		})
+		return
+	}
+
+	var req models.MarkWordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if req.WordID == 0 && req.Word == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "word_id or word is required",
+		})
+		return
+	}
+
+	level := models.KnowledgeKnown
+	if req.KnowledgeLevel != nil {
+		level = *req.KnowledgeLevel
+	}
+
+	var row models.UserWordKnowledge
+	var ambiguous []models.Word
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := ownsBook(tx, user.ID, req.BookID); err != nil {
+			return err
+		}
+		matches, err := knowledge.Resolve(tx, []models.WordRef{req.WordRef})
+		if err != nil {
+			return err
+		}
+		match := matches[0]
+		if match.Ambiguous() {
+			ambiguous = match.Candidates
+			return nil
+		}
+		if !match.Resolved() {
+			if match.Ref.WordID != 0 || match.Ref.Reading == "" {
+				return gorm.ErrRecordNotFound
+			}
+			word := models.Word{SurfaceForm: match.Ref.Word, Reading: match.Ref.Reading, BaseForm: match.Ref.Word}
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&word).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("surface_form = ? AND reading = ?", word.SurfaceForm, word.Reading).First(&word).Error; err != nil {
+				return err
+			}
+			match.WordID = word.ID
+		}
+
+		// A mark made while reading a book counts as meeting the word
+		update := knowledge.Update{Level: &level, Notes: req.Notes, FirstSeenBookID: req.BookID, Encountered: req.BookID != nil}
+		if _, err := knowledge.Apply(tx, user.ID, []uint{match.WordID}, update); err != nil {
+			return err
+		}
+		return tx.Preload("Word").Where("user_id = ? AND word_id = ?", user.ID, match.WordID).First(&row).Error
+	})
+	switch {
+	case errors.Is(err, errBookNotFound):
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Book not found",
+		})
+		return
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Word not found",
+		})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to update word knowledge",
+		})
+		return
+	}
+	if ambiguous != nil {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":      "Word is ambiguous; give a reading or word_id",
+			"candidates": ambiguous,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"knowledge":           row,
+		"total_words_learned": h.totalWordsLearned(user.ID),
+	})
+}
+
+// SetWordsKnowledge sets one knowledge level on a list of words
+func (h *Handler) SetWordsKnowledge(c *gin.Context) {
+	var req models.BulkKnowledgeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	h.bulkUpdate(c, req.Words, knowledge.Update{Level: req.KnowledgeLevel, FirstSeenBookID: req.BookID}, req.BookID)
+}
+
+// IgnoreWords marks a list of words as ignored, or clears the flag when
+// "ignored" is false. Ignored words never count as learned and never get
+// furigana.
+func (h *Handler) IgnoreWords(c *gin.Context) {
+	var req models.BulkIgnoreRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	ignored := true
+	if req.Ignored != nil {
+		ignored = *req.Ignored
+	}
+	h.bulkUpdate(c, req.Words, knowledge.Update{Ignored: &ignored}, nil)
+}
+
+// bulkUpdate applies an update to every word that resolves and reports the
+// ones that did not
+func (h *Handler) bulkUpdate(c *gin.Context, refs []models.WordRef, update knowledge.Update, bookID *uint) {
+	user, err := middleware.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "User not found",
+		})
+		return
+	}
+
+	unmatched := []models.WordRef{}
+	ambiguous := []knowledge.Match{}
+	updated := 0
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := ownsBook(tx, user.ID, bookID); err != nil {
+			return err
+		}
+		matches, err := knowledge.Resolve(tx, refs)
+		if err != nil {
+			return err
+		}
+		var ids []uint
+		for _, m := range matches {
+			switch {
+			case m.Resolved():
+				ids = append(ids, m.WordID)
+			case m.Ambiguous():
+				ambiguous = append(ambiguous, m)
+			default:
+				unmatched = append(unmatched, m.Ref)
+			}
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+		changes, err := knowledge.Apply(tx, user.ID, ids, update)
+		updated = len(changes)
+		return err
+	})
+	if errors.Is(err, errBookNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Book not found",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to update word knowledge",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"updated":             updated,
+		"unmatched":           unmatched,
+		"ambiguous":           ambiguous,
+		"total_words_learned": h.totalWordsLearned(user.ID),
+	})
+}
+
+// ownsBook checks that an optional book ID names one of the user's books
+func ownsBook(tx *gorm.DB, userID uint, bookID *uint) error {
+	if bookID == nil {
+		return nil
+	}
+	var count int64
+	if err := tx.Model(&models.Book{}).Where("id = ? AND user_id = ?", *bookID, userID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return errBookNotFound
+	}
+	return nil
+}
+
+func (h *Handler) totalWordsLearned(userID uint) int {
+	var user models.User
+	h.db.Select("total_words_learned").First(&user, userID)
+	return user.TotalWordsLearned
+}
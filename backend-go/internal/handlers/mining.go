@@ -0,0 +1,480 @@
+package handlers
+
+import (
+	"html"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"japanese-learning-app/internal/cards"
+	"japanese-learning-app/internal/knowledge"
+	"japanese-learning-app/internal/middleware"
+	"japanese-learning-app/internal/models"
+	"japanese-learning-app/internal/processing"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// sentenceBatchSize is how many sentences are scanned per query
+const sentenceBatchSize = 2000
+
+// MiningTarget is the one unknown word of an i+1 sentence
+type MiningTarget struct {
+	WordID        uint   `json:"word_id"`
+	Word          string `json:"word"`
+	Reading       string `json:"reading"`
+	JLPTLevel     *int   `json:"jlpt_level"`
+	FrequencyRank *int   `json:"frequency_rank"`
+	StartPosition int    `json:"start_position"` // -1 if the word could not be located
+	EndPosition   int    `json:"end_position"`
+	InSRS         bool   `json:"in_srs"`
+}
+
+// IPlusOneSentence is a sentence in which the user knows every word but one
+type IPlusOneSentence struct {
+	BookID    uint            `json:"book_id"`
+	BookTitle string          `json:"book_title"`
+	Sentence  SentenceContext `json:"sentence"`
+	Target    MiningTarget    `json:"target"`
+}
+
+// GetIPlusOneSentences finds sentences across the user's analyzed books
+// with exactly one unknown word. Filters: ?book_id=, ?min_frequency_rank=
+// and ?max_frequency_rank= on the unknown word (1 = most frequent),
+// ?min_words= (default 3) and ?per_word= (sentences per unknown word,
+// default 3, 0 = all). Results are ordered by the unknown word's frequency
+// and paged with ?offset= and ?limit=.
+func (h *Handler) GetIPlusOneSentences(c *gin.Context) {
+	user, err := middleware.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "User not found",
+		})
+		return
+	}
+
+	minRank, ok1 := optionalInt(c, "min_frequency_rank")
+	maxRank, ok2 := optionalInt(c, "max_frequency_rank")
+	minWords, ok3 := optionalInt(c, "min_words")
+	perWord, ok4 := optionalInt(c, "per_word")
+	if !ok1 || !ok2 || !ok3 || !ok4 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid filter",
+		})
+		return
+	}
+	if minWords == nil {
+		minWords = intPtr(3)
+	}
+	if perWord == nil {
+		perWord = intPtr(3)
+	}
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	offset = max(offset, 0)
+	limit = min(max(limit, 1), 200)
+
+	query := h.db.Model(&models.Book{}).
+		Select("id", "title").
+		Where("user_id = ? AND processing_status = ?", user.ID, processing.StatusCompleted)
+	if raw := c.Query("book_id"); raw != "" {
+		bookID, err := strconv.ParseUint(raw, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid book ID",
+			})
+			return
+		}
+		query = query.Where("id = ?", bookID)
+	}
+	var books []models.Book
+	if err := query.Find(&books).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to fetch books",
+		})
+		return
+	}
+
+	results, err := h.findIPlusOne(user.ID, books, *minWords)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to search sentences",
+		})
+		return
+	}
+
+	// Filter on the target words, then order and cap per word
+	targets, err := h.loadTargets(user.ID, results)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to load words",
+		})
+		return
+	}
+	filtered := results[:0]
+	for _, r := range results {
+		rank := targets[r.target].FrequencyRank
+		if (minRank != nil || maxRank != nil) && rank == nil {
+			continue
+		}
+		if (minRank != nil && *rank < *minRank) || (maxRank != nil && *rank > *maxRank) {
+			continue
+		}
+		filtered = append(filtered, r)
+	}
+	sort.SliceStable(filtered, func(i, j int) bool {
+		a, b := targets[filtered[i].target].FrequencyRank, targets[filtered[j].target].FrequencyRank
+		if (a == nil) != (b == nil) {
+			return a != nil
+		}
+		if a != nil && *a != *b {
+			return *a < *b
+		}
+		return filtered[i].target < filtered[j].target
+	})
+	if *perWord > 0 {
+		perTarget := make(map[uint]int)
+		capped := filtered[:0]
+		for _, r := range filtered {
+			if perTarget[r.target] < *perWord {
+				perTarget[r.target]++
+				capped = append(capped, r)
+			}
+		}
+		filtered = capped
+	}
+
+	total := len(filtered)
+	page := filtered[min(offset, total):min(offset+limit, total)]
+	sentences, err := h.iPlusOnePage(books, page, targets)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to fetch sentences",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"total":     total,
+		"offset":    offset,
+		"sentences": sentences,
+	})
+}
+
+// iPlusOneHit is a matching sentence before it is filled in for output
+type iPlusOneHit struct {
+	sentence models.BookSentence
+	target   uint
+}
+
+// findIPlusOne scans the books' stored sentences for ones with exactly one
+// word the user does not know, counting repeats of that word once
+func (h *Handler) findIPlusOne(userID uint, books []models.Book, minWords int) ([]iPlusOneHit, error) {
+	if len(books) == 0 {
+		return nil, nil
+	}
+	covered, err := knowledge.CoveredWords(h.db, userID)
+	if err != nil {
+		return nil, err
+	}
+	bookIDs := make([]uint, len(books))
+	for i, b := range books {
+		bookIDs[i] = b.ID
+	}
+
+	var hits []iPlusOneHit
+	var batch []models.BookSentence
+	err = h.db.Where("book_id IN ?", bookIDs).FindInBatches(&batch, sentenceBatchSize, func(tx *gorm.DB, _ int) error {
+		for _, s := range batch {
+			if len(s.WordIDs) < minWords {
+				continue
+			}
+			var target uint
+			single := true
+			for _, id := range s.WordIDs {
+				if covered[id] || id == target {
+					continue
+				}
+				if target != 0 {
+					single = false
+					break
+				}
+				target = id
+			}
+			if single && target != 0 {
+				s.WordIDs = nil
+				hits = append(hits, iPlusOneHit{sentence: s, target: target})
+			}
+		}
+		return nil
+	}).Error
+	return hits, err
+}
+
+// loadTargets loads the target words of the hits, with whether the user
+// already has a card for each
+func (h *Handler) loadTargets(userID uint, hits []iPlusOneHit) (map[uint]*MiningTarget, error) {
+	seen := make(map[uint]bool)
+	var ids []uint
+	for _, hit := range hits {
+		if !seen[hit.target] {
+			seen[hit.target] = true
+			ids = append(ids, hit.target)
+		}
+	}
+
+	targets := make(map[uint]*MiningTarget, len(ids))
+	for start := 0; start < len(ids); start += 1000 {
+		chunk := ids[start:min(start+1000, len(ids))]
+		var words []models.Word
+		if err := h.db.Where("id IN ?", chunk).Find(&words).Error; err != nil {
+			return nil, err
+		}
+		for _, w := range words {
+			targets[w.ID] = &MiningTarget{
+				WordID:        w.ID,
+				Word:          w.SurfaceForm,
+				Reading:       w.Reading,
+				JLPTLevel:     w.JLPTLevel,
+				FrequencyRank: w.FrequencyRank,
+				StartPosition: -1,
+				EndPosition:   -1,
+			}
+		}
+		var carded []uint
+		if err := h.db.Model(&models.SRSCard{}).Where("user_id = ? AND word_id IN ?", userID, chunk).
+			Distinct().Pluck("word_id", &carded).Error; err != nil {
+			return nil, err
+		}
+		for _, id := range carded {
+			if t := targets[id]; t != nil {
+				t.InSRS = true
+			}
+		}
+	}
+	for _, id := range ids {
+		if targets[id] == nil {
+			// Deleted word; keep the hit usable
+			targets[id] = &MiningTarget{WordID: id, StartPosition: -1, EndPosition: -1}
+		}
+	}
+	return targets, nil
+}
+
+// iPlusOnePage fills in the text and target position of a page of hits
+func (h *Handler) iPlusOnePage(books []models.Book, page []iPlusOneHit, targets map[uint]*MiningTarget) ([]IPlusOneSentence, error) {
+	titles := make(map[uint]string, len(books))
+	for _, b := range books {
+		titles[b.ID] = b.Title
+	}
+
+	texts := make(map[uint][]rune)
+	sentences := make([]IPlusOneSentence, 0, len(page))
+	for _, hit := range page {
+		text, ok := texts[hit.sentence.BookID]
+		if !ok {
+			var book models.Book
+			if err := h.db.Select("id", "extracted_text").First(&book, hit.sentence.BookID).Error; err != nil {
+				return nil, err
+			}
+			text = []rune(book.ExtractedText)
+			texts[book.ID] = text
+		}
+
+		sentence := sentenceContext(text, hit.sentence)
+		target := *targets[hit.target]
+		for _, tok := range h.tokenizeRange(text, sentence.StartPosition, sentence.EndPosition) {
+			if tok.BaseForm == target.Word && tok.BaseReading == target.Reading {
+				target.StartPosition, target.EndPosition = tok.Start, tok.End
+				break
+			}
+		}
+		sentences = append(sentences, IPlusOneSentence{
+			BookID:    hit.sentence.BookID,
+			BookTitle: titles[hit.sentence.BookID],
+			Sentence:  sentence,
+			Target:    target,
+		})
+	}
+	return sentences, nil
+}
+
+// optionalInt reads an optional integer query parameter; ok is false if it
+// is present but not a non-negative integer
+func optionalInt(c *gin.Context, name string) (*int, bool) {
+	raw := c.Query(name)
+	if raw == "" {
+		return nil, true
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 0 {
+		return nil, false
+	}
+	return &n, true
+}
+
+func intPtr(n int) *int {
+	return &n
+}
+
+// maxMinedSentence bounds the length of a mined sentence in characters
+const maxMinedSentence = 1000
+
+// MineSentence turns a sentence of a book into an SRS card for one word of
+// it. The front shows the sentence with the word highlighted, the back the
+// word's reading, definition and source. A "mined" annotation marks the
+// sentence in the book. Mining a word that already has a sentence card
+// returns that card with 409, the new sentence still marked.
+func (h *Handler) MineSentence(c *gin.Context) {
+	user, err := middleware.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "User not found",
+		})
+		return
+	}
+
+	var req models.MineSentenceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	var book models.Book
+	if err := h.db.Where("id = ? AND user_id = ?", req.BookID, user.ID).First(&book).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Book not found",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to fetch book",
+		})
+		return
+	}
+	var word models.Word
+	if err := h.db.First(&word, req.WordID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Word not found",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to fetch word",
+		})
+		return
+	}
+
+	text := []rune(book.ExtractedText)
+	start, end := *req.StartPosition, req.EndPosition
+	if end <= start || end > len(text) || end-start > maxMinedSentence {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid sentence range",
+		})
+		return
+	}
+
+	targetStart, targetEnd := -1, -1
+	if req.TargetStart != nil && req.TargetEnd != nil {
+		targetStart, targetEnd = *req.TargetStart, *req.TargetEnd
+	} else {
+		for _, tok := range h.tokenizeRange(text, start, end) {
+			if tok.BaseForm == word.SurfaceForm && tok.BaseReading == word.Reading {
+				targetStart, targetEnd = tok.Start, tok.End
+				break
+			}
+		}
+	}
+	if targetStart < start || targetEnd > end || targetEnd <= targetStart {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Target word is not in the sentence",
+		})
+		return
+	}
+
+	sentence := &SentenceContext{Index: -1, StartPosition: start, EndPosition: end, Text: string(text[start:end])}
+	card := models.SRSCard{
+		UserID:   user.ID,
+		WordID:   word.ID,
+		CardType: models.CardTypeSentence,
+		State:    models.CardStateNew,
+		DueDate:  time.Now(),
+	}
+	card.FrontContent = map[string]interface{}{
+		"sentence":      sentence.Text,
+		"sentence_html": highlight(text[start:end], targetStart-start, targetEnd-start),
+		"target_start":  targetStart - start,
+		"target_end":    targetEnd - start,
+	}
+	card.BackContent = map[string]interface{}{
+		"text":       word.SurfaceForm,
+		"furigana":   word.Reading,
+		"definition": h.cardDefinition(c.Request.Context(), &word),
+		"source":     newCardExample(&book, sentence),
+	}
+
+	var created bool
+	var annotation models.BookAnnotation
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		deck, err := cards.DefaultDeck(tx, user.ID)
+		if err != nil {
+			return err
+		}
+		card.DeckID = &deck.ID
+		// Mining a word again still marks the sentence, linked to the card
+		// the word already has
+		created, err = cards.Insert(tx, &card)
+		if err != nil {
+			return err
+		}
+		annotation = models.BookAnnotation{
+			UserID:         user.ID,
+			BookID:         book.ID,
+			StartPosition:  start,
+			EndPosition:    end,
+			SelectedText:   sentence.Text,
+			AnnotationType: models.AnnotationMined,
+			AnnotationData: map[string]interface{}{
+				"card_id":      card.ID,
+				"word_id":      word.ID,
+				"target_start": targetStart,
+				"target_end":   targetEnd,
+			},
+		}
+		return tx.Create(&annotation).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to create card",
+		})
+		return
+	}
+	card.Word = word
+
+	if !created {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":         "Word already has a sentence card",
+			"card":          card,
+			"annotation_id": annotation.ID,
+		})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{
+		"card":          card,
+		"annotation_id": annotation.ID,
+		"created":       true,
+	})
+}
+
+// highlight renders a sentence as HTML with text[start:end] in bold
+func highlight(text []rune, start, end int) string {
+	return html.EscapeString(string(text[:start])) +
+		"<b>" + html.EscapeString(string(text[start:end])) + "</b>" +
+		html.EscapeString(string(text[end:]))
+}
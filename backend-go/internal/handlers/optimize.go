@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"japanese-learning-app/internal/middleware"
+	"japanese-learning-app/internal/models"
+	"japanese-learning-app/internal/optimizer"
+
+	"github.com/gin-gonic/gin"
+)
+
+// OptimizeWeights starts fitting the user's FSRS weights to their review
+// history in the background. The weights are replaced only if they predict
+// held-out cards better; GetOptimizations reports the outcome.
+func (h *Handler) OptimizeWeights(c *gin.Context) {
+	user, err := middleware.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "User not found",
+		})
+		return
+	}
+
+	run, err := h.optimizer.Start(user.ID, optimizer.TriggerManual)
+	if err == optimizer.ErrRunning {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "An optimization is already running",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to start optimization",
+		})
+		return
+	}
+
+	go func(runID uint) {
+		if err := h.optimizer.Run(runID); err != nil {
+			log.Printf("FSRS optimization failed: %v", err)
+		}
+	}(run.ID)
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":      "Optimization started",
+		"optimization": run,
+	})
+}
+
+// GetOptimizations lists the user's latest FSRS optimizer runs, newest first
+func (h *Handler) GetOptimizations(c *gin.Context) {
+	user, err := middleware.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "User not found",
+		})
+		return
+	}
+
+	var runs []models.FSRSOptimization
+	if err := h.db.Where("user_id = ?", user.ID).Order("id DESC").Limit(10).Find(&runs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to fetch optimizations",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"optimizations": runs,
+	})
+}
@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"japanese-learning-app/internal/middleware"
+	"japanese-learning-app/internal/models"
+	"japanese-learning-app/internal/srs"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// UpdateCurrentUser changes the current user's language or time zone. The
+// time zone sets where SRS days begin and end.
+func (h *Handler) UpdateCurrentUser(c *gin.Context) {
+	user, err := middleware.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "User not found",
+		})
+		return
+	}
+
+	var req models.UpdateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	updates := make(map[string]interface{})
+	if req.PreferredLanguage != nil {
+		updates["preferred_language"] = *req.PreferredLanguage
+	}
+	if req.Timezone != nil {
+		if _, err := time.LoadLocation(*req.Timezone); err != nil || *req.Timezone == "Local" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Unknown timezone",
+			})
+			return
+		}
+		updates["timezone"] = *req.Timezone
+	}
+	if len(updates) > 0 {
+		if err := h.db.Model(&models.User{ID: user.ID}).Updates(updates).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to update user",
+			})
+			return
+		}
+	}
+	if req.PreferredLanguage != nil {
+		user.PreferredLanguage = *req.PreferredLanguage
+	}
+	if req.Timezone != nil {
+		user.Timezone = *req.Timezone
+	}
+
+	c.JSON(http.StatusOK, user.ToResponse())
+}
+
+// UpdatePreferences merges the request body into the user's learning
+// preferences; a null value removes a preference. Switching the SRS
+// scheduler reschedules all of the user's cards with the new one.
+func (h *Handler) UpdatePreferences(c *gin.Context) {
+	user, err := middleware.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "User not found",
+		})
+		return
+	}
+
+	var changes map[string]interface{}
+	if err := c.ShouldBindJSON(&changes); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if err := validatePreferences(changes); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	var prefs map[string]interface{}
+	var scheduler srs.Scheduler
+	migrated := 0
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		// Merge into the stored preferences, held until saved, so a change
+		// made meanwhile such as newly fitted FSRS weights is not lost
+		var current models.User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&current, user.ID).Error; err != nil {
+			return err
+		}
+		before := current.PreferenceString(models.PrefScheduler, srs.SchedulerSM2)
+		prefs = make(map[string]interface{}, len(current.LearningPreferences)+len(changes))
+		for k, v := range current.LearningPreferences {
+			prefs[k] = v
+		}
+		for k, v := range changes {
+			if v == nil {
+				delete(prefs, k)
+			} else {
+				prefs[k] = v
+			}
+		}
+		current.LearningPreferences = prefs
+		scheduler = srs.ForUser(&current)
+
+		if err := tx.Model(&models.User{ID: user.ID}).Select("learning_preferences").
+			Updates(&models.User{LearningPreferences: prefs}).Error; err != nil {
+			return err
+		}
+		if scheduler.Name() == before {
+			return nil
+		}
+		migrated, err = srs.Migrate(tx, user.ID, scheduler)
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to update preferences",
+		})
+		return
+	}
+	user.LearningPreferences = prefs
+
+	c.JSON(http.StatusOK, gin.H{
+		"learning_preferences": prefs,
+		"scheduler":            scheduler.Name(),
+		"cards_migrated":       migrated,
+	})
+}
+
+// maxDailyLimit bounds the daily new card and review limits
+const maxDailyLimit = 9999
+
+// validatePreferences checks the values of the preferences the server uses
+func validatePreferences(prefs map[string]interface{}) error {
+	for key, v := range prefs {
+		if v == nil {
+			continue
+		}
+		switch key {
+		case models.PrefFuriganaThreshold:
+			if !wholeNumber(v, models.KnowledgeUnknown, models.KnowledgeMastered) {
+				return fmt.Errorf("%s must be a knowledge level from %d to %d", key, models.KnowledgeUnknown, models.KnowledgeMastered)
+			}
+		case models.PrefKnownKanji:
+			if _, ok := v.(string); !ok {
+				return fmt.Errorf("%s must be a string", key)
+			}
+		case models.PrefScheduler:
+			if name, ok := v.(string); !ok || !srs.ValidScheduler(name) {
+				return fmt.Errorf("%s must be %s or %s", key, srs.SchedulerSM2, srs.SchedulerFSRS)
+			}
+		case models.PrefFSRSWeights:
+			if _, ok := srs.ParseWeights(v); !ok {
+				return fmt.Errorf("%s must be a list of %d numbers", key, srs.FSRSWeightCount)
+			}
+		case models.PrefNewCardsPerDay, models.PrefMaxReviewsPerDay:
+			if !wholeNumber(v, 0, maxDailyLimit) {
+				return fmt.Errorf("%s must be a whole number from 0 to %d", key, maxDailyLimit)
+			}
+		case models.PrefLearnAheadMinutes:
+			if !wholeNumber(v, 0, 24*60) {
+				return fmt.Errorf("%s must be a whole number of minutes from 0 to %d", key, 24*60)
+			}
+		case models.PrefDayRolloverHour:
+			if !wholeNumber(v, 0, 23) {
+				return fmt.Errorf("%s must be an hour from 0 to 23", key)
+			}
+		case models.PrefLeechThreshold:
+			if !wholeNumber(v, 0, 99) {
+				return fmt.Errorf("%s must be a whole number from 0 (off) to 99", key)
+			}
+		case models.PrefLeechAction:
+			if a, ok := v.(string); !ok || (a != srs.LeechActionTag && a != srs.LeechActionSuspend) {
+				return fmt.Errorf("%s must be %s or %s", key, srs.LeechActionTag, srs.LeechActionSuspend)
+			}
+		case models.PrefDesiredRetention:
+			if r, ok := v.(float64); !ok || !srs.ValidRetention(r) {
+				return fmt.Errorf("%s must be between %g and %g", key, srs.MinDesiredRetention, srs.MaxDesiredRetention)
+			}
+		}
+	}
+	return nil
+}
+
+// wholeNumber reports whether a JSON value is a whole number from lo to hi
+func wholeNumber(v interface{}, lo, hi int) bool {
+	n, ok := v.(float64)
+	return ok && n == math.Trunc(n) && n >= float64(lo) && n <= float64(hi)
+}
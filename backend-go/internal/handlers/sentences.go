@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"japanese-learning-app/internal/middleware"
+	"japanese-learning-app/internal/models"
+	"japanese-learning-app/internal/textproc"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// SentenceContext is a sentence of a book's text with its position
+type SentenceContext struct {
+	Index         int    `json:"index"` // -1 if the book has not been analyzed yet
+	StartPosition int    `json:"start_position"`
+	EndPosition   int    `json:"end_position"`
+	Text          string `json:"text"`
+}
+
+// GetBookSentences returns the sentence containing ?position=, or a page of
+// sentences (?offset=, ?limit=) when no position is given
+func (h *Handler) GetBookSentences(c *gin.Context) {
+	_, book, ok := h.loadUserBook(c)
+	if !ok {
+		return
+	}
+
+	if raw := c.Query("position"); raw != "" {
+		pos, err := strconv.Atoi(raw)
+		if err != nil || pos < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid position",
+			})
+			return
+		}
+		sentence, err := h.sentenceAt(book, pos)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to fetch sentence",
+			})
+			return
+		}
+		if sentence == nil {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "No sentence at this position",
+			})
+			return
+		}
+		c.JSON(http.StatusOK, sentence)
+		return
+	}
+
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	offset = max(offset, 0)
+	limit = min(max(limit, 1), 1000)
+
+	var rows []models.BookSentence
+	if err := h.db.Where("book_id = ?", book.ID).Order("sentence_index").Offset(offset).Limit(limit).Find(&rows).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to fetch sentences",
+		})
+		return
+	}
+
+	text := []rune(book.ExtractedText)
+	sentences := make([]SentenceContext, 0, len(rows))
+	for _, row := range rows {
+		sentences = append(sentences, sentenceContext(text, row))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"book_id":   book.ID,
+		"offset":    offset,
+		"sentences": sentences,
+	})
+}
+
+// sentenceAt finds the sentence containing a character position. Books that
+// have not been analyzed yet fall back to segmenting the surrounding line.
+// Returns nil if the position is outside every sentence.
+func (h *Handler) sentenceAt(book *models.Book, pos int) (*SentenceContext, error) {
+	text := []rune(book.ExtractedText)
+	if pos >= len(text) {
+		return nil, nil
+	}
+
+	var row models.BookSentence
+	err := h.db.Where("book_id = ? AND start_position <= ? AND end_position > ?", book.ID, pos, pos).
+		Order("start_position DESC").
+		First(&row).Error
+	if err == nil {
+		sentence := sentenceContext(text, row)
+		return &sentence, nil
+	}
+	if err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+
+	var count int64
+	if err := h.db.Model(&models.BookSentence{}).Where("book_id = ?", book.ID).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		// Analyzed, and the position falls between sentences
+		return nil, nil
+	}
+
+	lineStart := pos
+	for lineStart > 0 && text[lineStart-1] != '\n' {
+		lineStart--
+	}
+	lineEnd := pos
+	for lineEnd < len(text) && text[lineEnd] != '\n' {
+		lineEnd++
+	}
+	for _, s := range textproc.SplitSentences(text[lineStart:lineEnd]) {
+		if lineStart+s.Start <= pos && pos < lineStart+s.End {
+			return &SentenceContext{
+				Index:         -1,
+				StartPosition: lineStart + s.Start,
+				EndPosition:   lineStart + s.End,
+				Text:          string(text[lineStart+s.Start : lineStart+s.End]),
+			}, nil
+		}
+	}
+	return nil, nil
+}
+
+// lookupContext returns the sentence named by the ?book_id= and ?position=
+// query parameters of a lookup, if both are present and valid
+func (h *Handler) lookupContext(c *gin.Context) *SentenceContext {
+	user, err := middleware.GetCurrentUser(c)
+	if err != nil {
+		return nil
+	}
+	bookID, err := strconv.ParseUint(c.Query("book_id"), 10, 32)
+	if err != nil {
+		return nil
+	}
+	pos, err := strconv.Atoi(c.Query("position"))
+	if err != nil || pos < 0 {
+		return nil
+	}
+
+	var book models.Book
+	if err := h.db.Where("id = ? AND user_id = ?", bookID, user.ID).First(&book).Error; err != nil {
+		return nil
+	}
+	sentence, err := h.sentenceAt(&book, pos)
+	if err != nil {
+		return nil
+	}
+	return sentence
+}
+
+func sentenceContext(text []rune, row models.BookSentence) SentenceContext {
+	start := min(max(row.StartPosition, 0), len(text))
+	end := min(max(row.EndPosition, start), len(text))
+	return SentenceContext{
+		Index:         row.Index,
+		StartPosition: start,
+		EndPosition:   end,
+		Text:          string(text[start:end]),
+	}
+}
@@ -0,0 +1,535 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"japanese-learning-app/internal/cards"
+	"japanese-learning-app/internal/middleware"
+	"japanese-learning-app/internal/models"
+	"japanese-learning-app/internal/srs"
+	"japanese-learning-app/internal/textproc"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// maxCardSenses bounds how many dictionary senses go on the back of a card
+const maxCardSenses = 3
+
+// CreateCard adds a word to one of the user's decks, with a card of each
+// type the deck has turned on (or only of card_type) and the sentence at
+// book_id/position as their example. Types the word already has a card of
+// come back as the existing card.
+func (h *Handler) CreateCard(c *gin.Context) {
+	user, err := middleware.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "User not found",
+		})
+		return
+	}
+
+	var req models.CreateCardRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	var word models.Word
+	if err := h.db.First(&word, req.WordID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Word not found",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to fetch word",
+		})
+		return
+	}
+
+	deck, ok := h.loadDeck(c, user.ID, req.DeckID)
+	if !ok {
+		return
+	}
+	if deck.IsFiltered {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Cards cannot be added to a filtered deck",
+		})
+		return
+	}
+	cardTypes := deck.CardTypes
+	if req.CardType != "" {
+		cardTypes = []string{req.CardType}
+	}
+
+	var example *cards.Example
+	if req.BookID != nil && req.Position != nil {
+		var book models.Book
+		if err := h.db.Where("id = ? AND user_id = ?", *req.BookID, user.ID).First(&book).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Book not found",
+			})
+			return
+		}
+		sentence, err := h.sentenceAt(&book, *req.Position)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to fetch sentence",
+			})
+			return
+		}
+		if sentence != nil {
+			example = newCardExample(&book, sentence)
+		}
+	}
+
+	note := cards.Note{Word: &word, Definition: h.cardDefinition(c.Request.Context(), &word), Example: example}
+	now := time.Now()
+	made := make([]models.SRSCard, 0, len(cardTypes))
+	created := 0
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		for _, cardType := range cardTypes {
+			card := cards.New(user.ID, deck.ID, cardType, note, now)
+			ok, err := cards.Insert(tx, &card)
+			if err != nil {
+				return err
+			}
+			if ok {
+				created++
+			}
+			card.Word = word
+			made = append(made, card)
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to create card",
+		})
+		return
+	}
+
+	status := http.StatusCreated
+	if created == 0 {
+		status = http.StatusOK
+	}
+	c.JSON(status, gin.H{
+		"cards":   made,
+		"created": created,
+	})
+}
+
+func newCardExample(book *models.Book, sentence *SentenceContext) *cards.Example {
+	example := &cards.Example{
+		Text:          sentence.Text,
+		BookID:        book.ID,
+		BookTitle:     book.Title,
+		StartPosition: sentence.StartPosition,
+		EndPosition:   sentence.EndPosition,
+	}
+	for _, chapter := range book.Chapters() {
+		if chapter.StartPos <= sentence.StartPosition && sentence.StartPosition < chapter.EndPos {
+			example.Chapter = chapter.Title
+			break
+		}
+	}
+	return example
+}
+
+// cardDefinition summarizes a word's dictionary senses for the back of a
+// card. Returns "" if no dictionary has the word.
+func (h *Handler) cardDefinition(ctx context.Context, word *models.Word) string {
+	// A failed fallback still leaves whatever the local dictionaries had
+	result, _ := h.dictionary.Lookup(ctx, word.SurfaceForm)
+	if result == nil || len(result.Entries) == 0 {
+		return ""
+	}
+
+	entry := result.Entries[0]
+	for _, e := range result.Entries {
+		if textproc.ToHiragana(e.Reading) == word.Reading {
+			entry = e
+			break
+		}
+	}
+
+	var senses []string
+	for _, s := range entry.Senses {
+		if len(senses) == maxCardSenses {
+			break
+		}
+		if len(s.Definitions) > 0 {
+			senses = append(senses, strings.Join(s.Definitions, ", "))
+		}
+	}
+	return strings.Join(senses, "; ")
+}
+
+// maxDueCards bounds how many cards GetDueCards returns at once
+const maxDueCards = 500
+
+// GetDueCards returns the cards to study now, within the user's daily
+// limits and in their study day: learning cards that are due, then today's
+// reviews, then new cards, then learning cards due within the learn-ahead
+// window. Suspended and buried cards are left out. Each card comes with when
+// it would next be due for every grade; counts are what is left for the day.
+// With deck_id only that deck's cards are studied; a filtered deck's review
+// and new cards are all shown, whether due or not and beyond the limits.
+func (h *Handler) GetDueCards(c *gin.Context) {
+	user, err := middleware.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "User not found",
+		})
+		return
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	limit = min(max(limit, 1), maxDueCards)
+
+	var deck *models.Deck
+	if raw := c.Query("deck_id"); raw != "" {
+		id, err := strconv.ParseUint(raw, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid deck ID",
+			})
+			return
+		}
+		deckID := uint(id)
+		var ok bool
+		if deck, ok = h.loadDeck(c, user.ID, &deckID); !ok {
+			return
+		}
+	}
+
+	now := time.Now()
+	study := srs.UserStudySettings(user)
+	if err := cards.Unbury(h.db, user.ID, now); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to fetch due cards",
+		})
+		return
+	}
+	queue, err := h.studyQueue(user.ID, deck, study, now, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to fetch due cards",
+		})
+		return
+	}
+
+	scheduler := srs.ForUser(user)
+	due := make([]DueCard, 0, len(queue.Cards))
+	for _, card := range queue.Cards {
+		due = append(due, DueCard{SRSCard: card, NextDue: nextDue(srs.Preview(scheduler, card, now))})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"due_cards": due,
+		"counts": gin.H{
+			"new":      queue.New,
+			"learning": queue.Learning,
+			"review":   queue.Review,
+		},
+		"studied_today": gin.H{
+			"new":    queue.NewStudied,
+			"review": queue.ReviewsStudied,
+		},
+		"limits": gin.H{
+			"new_cards_per_day":   study.NewCardsPerDay,
+			"max_reviews_per_day": study.MaxReviewsPerDay,
+		},
+		"day_ends_at": study.DayEnd(now),
+	})
+}
+
+// studyQueue is what is left to study today
+type studyQueue struct {
+	Cards []models.SRSCard // In study order, up to the requested limit
+
+	// Cards left today, within the daily limits
+	New      int
+	Learning int
+	Review   int
+
+	// Cards studied so far today
+	NewStudied     int
+	ReviewsStudied int
+}
+
+// studyQueue builds the user's queue for the study day containing now, of
+// one deck or, if deck is nil, all of them
+func (h *Handler) studyQueue(userID uint, deck *models.Deck, study srs.StudySettings, now time.Time, limit int) (*studyQueue, error) {
+	dayEnd := study.DayEnd(now)
+	q := &studyQueue{}
+	var err error
+	if q.NewStudied, q.ReviewsStudied, err = h.studiedToday(userID, study.DayStart(now)); err != nil {
+		return nil, err
+	}
+
+	available := func() *gorm.DB {
+		q := h.db.Model(&models.SRSCard{}).
+			Where("user_id = ? AND is_suspended = ? AND is_buried = ?", userID, false, false)
+		if deck != nil {
+			q = q.Where("deck_id = ?", deck.ID)
+		}
+		return q
+	}
+	// A filtered deck is studied in full, as it was built
+	filtered := deck != nil && deck.IsFiltered
+	reviews := func() *gorm.DB {
+		q := available().Where("state = ?", models.CardStateReview)
+		if !filtered {
+			q = q.Where("due_date < ?", dayEnd)
+		}
+		return q
+	}
+	learningStates := []string{models.CardStateLearning, models.CardStateRelearning}
+	var learning, review, fresh int64
+	if err := available().Where("state IN ? AND due_date <= ?", learningStates, now.Add(study.LearnAhead)).Count(&learning).Error; err != nil {
+		return nil, err
+	}
+	if err := reviews().Count(&review).Error; err != nil {
+		return nil, err
+	}
+	if err := available().Where("state = ?", models.CardStateNew).Count(&fresh).Error; err != nil {
+		return nil, err
+	}
+
+	// New cards also count against the review limit, as in Anki
+	q.Learning = int(learning)
+	q.Review = min(int(review), max(study.MaxReviewsPerDay-q.ReviewsStudied, 0))
+	q.New = min(int(fresh), max(study.NewCardsPerDay-q.NewStudied, 0), max(study.MaxReviewsPerDay-q.ReviewsStudied-q.Review, 0))
+	if filtered {
+		q.Review, q.New = int(review), int(fresh)
+	}
+
+	var undoneCards, learningCards, reviewCards, newCards []models.SRSCard
+	if err := available().Preload("Word").Where("undone_at IS NOT NULL").
+		Order("undone_at DESC").Order("id").Limit(limit).Find(&undoneCards).Error; err != nil {
+		return nil, err
+	}
+	if err := available().Preload("Word").Where("state IN ? AND due_date <= ?", learningStates, now.Add(study.LearnAhead)).
+		Order("due_date").Order("id").Limit(limit).Find(&learningCards).Error; err != nil {
+		return nil, err
+	}
+	if q.Review > 0 {
+		if err := reviews().Preload("Word").
+			Order("due_date").Order("id").Limit(min(q.Review, limit)).Find(&reviewCards).Error; err != nil {
+			return nil, err
+		}
+	}
+	if q.New > 0 {
+		if err := available().Preload("Word").Where("state = ?", models.CardStateNew).
+			Order("due_date").Order("id").Limit(min(q.New, limit)).Find(&newCards).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	// Learning cards not yet due wait until everything else is done
+	split := len(learningCards)
+	for i, card := range learningCards {
+		if card.DueDate.After(now) {
+			split = i
+			break
+		}
+	}
+	// Cards whose review was just undone come back first
+	seen := make(map[uint]bool, len(undoneCards))
+	for _, card := range undoneCards {
+		seen[card.ID] = true
+	}
+	q.Cards = append(q.Cards, undoneCards...)
+	for _, part := range [][]models.SRSCard{learningCards[:split], reviewCards, newCards, learningCards[split:]} {
+		for _, card := range part {
+			if !seen[card.ID] {
+				q.Cards = append(q.Cards, card)
+			}
+		}
+	}
+	if len(q.Cards) > limit {
+		q.Cards = q.Cards[:limit]
+	}
+	return q, nil
+}
+
+// studiedToday counts the new and review cards the user has studied since
+// the start of the day
+func (h *Handler) studiedToday(userID uint, dayStart time.Time) (newCards, reviews int, err error) {
+	var studied []struct {
+		OldState string
+		Count    int
+	}
+	err = h.db.Model(&models.ReviewHistory{}).
+		Select("old_state, COUNT(*) AS count").
+		Where("user_id = ? AND reviewed_at >= ? AND old_state IN ?", userID, dayStart, []string{models.CardStateNew, models.CardStateReview}).
+		Group("old_state").Scan(&studied).Error
+	for _, row := range studied {
+		if row.OldState == models.CardStateNew {
+			newCards = row.Count
+		} else {
+			reviews = row.Count
+		}
+	}
+	return newCards, reviews, err
+}
+
+// DueCard is a due card with when it would next be due for each grade,
+// keyed again, hard, good and easy
+type DueCard struct {
+	models.SRSCard
+	NextDue map[string]time.Time `json:"next_due"`
+}
+
+// ReviewCard grades a review of one of the user's cards, reschedules it and
+// records the review. A card that lapses too often is tagged as a leech.
+func (h *Handler) ReviewCard(c *gin.Context) {
+	user, err := middleware.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "User not found",
+		})
+		return
+	}
+
+	var req models.ReviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if req.ReviewContext == "" {
+		req.ReviewContext = "srs_session"
+	}
+
+	var card models.SRSCard
+	var review models.ReviewHistory
+	var leech bool
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		// Lock the card so a concurrent review or undo waits for this one
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND user_id = ?", req.CardID, user.ID).First(&card).Error; err != nil {
+			return err
+		}
+		if card.IsSuspended {
+			return errCardSuspended
+		}
+
+		now := time.Now()
+		review = models.ReviewHistory{
+			UserID:          user.ID,
+			CardID:          card.ID,
+			ReviewedAt:      now,
+			ResponseQuality: req.Grade,
+			ResponseTimeMs:  req.ResponseTimeMs,
+			OldState:        card.State,
+			OldStep:         card.LearningStep,
+			OldInterval:     card.IntervalDays,
+			OldEaseFactor:   card.EaseFactor,
+			OldStability:    card.Stability,
+			OldDifficulty:   card.Difficulty,
+			OldDueDate:      card.DueDate,
+
+			OldLapses:         card.Lapses,
+			OldRepetitions:    card.RepetitionCount,
+			OldStreak:         card.CurrentStreak,
+			OldLongestStreak:  card.LongestStreak,
+			OldIsLeech:        card.IsLeech,
+			OldIsSuspended:    card.IsSuspended,
+			OldLastReviewedAt: card.LastReviewedAt,
+			OldDeckID:         card.DeckID,
+			HasUndoSnapshot:   true,
+
+			ReviewContext: req.ReviewContext,
+			DeviceType:    req.DeviceType,
+		}
+		lapses := card.Lapses
+		srs.Review(srs.ForUser(user), &card, srs.Grade(req.Grade), now)
+		card.IsBuried = false
+		card.BuriedUntil = nil
+		card.UndoneAt = nil
+		leech = card.Lapses > lapses && srs.UserLeechSettings(user).Check(&card)
+		// A filtered deck keeps a card only until it is learned
+		if card.State == models.CardStateReview {
+			cards.ReturnHome(&card)
+		}
+		review.NewState = card.State
+		review.NewStep = card.LearningStep
+		review.NewInterval = card.IntervalDays
+		review.NewEaseFactor = card.EaseFactor
+		review.NewStability = card.Stability
+		review.NewDifficulty = card.Difficulty
+		review.NewDueDate = card.DueDate
+		review.NewIsSuspended = card.IsSuspended
+
+		if err := tx.Omit("Word").Save(&card).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&review).Error; err != nil {
+			return err
+		}
+		return burySiblings(tx, &card, srs.UserStudySettings(user).DayEnd(now))
+	})
+	switch {
+	case err == gorm.ErrRecordNotFound:
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Card not found",
+		})
+		return
+	case err == errCardSuspended:
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "Card is suspended",
+		})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to record review",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"card":   card,
+		"review": review,
+		"leech":  leech, // The card just hit the leech threshold
+	})
+}
+
+// burySiblings buries the reviewed card's siblings until the given end of
+// the study day, unless its home deck has that turned off
+func burySiblings(tx *gorm.DB, card *models.SRSCard, until time.Time) error {
+	if deckID := cards.HomeDeckID(card); deckID != nil {
+		var deck models.Deck
+		if err := tx.Select("bury_siblings").First(&deck, *deckID).Error; err != nil {
+			return err
+		}
+		if !deck.BurySiblings {
+			return nil
+		}
+	}
+	return cards.BurySiblings(tx, card, until)
+}
+
+// errCardSuspended is returned when reviewing a suspended card
+var errCardSuspended = errors.New("card is suspended")
+
+// nextDue converts a scheduler preview to its JSON form
+func nextDue(preview map[srs.Grade]time.Time) map[string]time.Time {
+	names := map[srs.Grade]string{srs.Again: "again", srs.Hard: "hard", srs.Good: "good", srs.Easy: "easy"}
+	due := make(map[string]time.Time, len(preview))
+	for g, t := range preview {
+		due[names[g]] = t
+	}
+	return due
+}
@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"japanese-learning-app/internal/cards"
+	"japanese-learning-app/internal/middleware"
+	"japanese-learning-app/internal/models"
+	"japanese-learning-app/internal/srs"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// UndoReview undoes the user's latest review: the card goes back to how it
+// was before it and to the front of the study queue, and the review is
+// deleted. A card changed since, for example by a review on another device
+// or a suspension, is left alone, as is a review recorded without the state
+// needed to undo it.
+func (h *Handler) UndoReview(c *gin.Context) {
+	user, err := middleware.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "User not found",
+		})
+		return
+	}
+
+	now := time.Now()
+	study := srs.UserStudySettings(user)
+	var card models.SRSCard
+	var review models.ReviewHistory
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("user_id = ?", user.ID).
+			Order("reviewed_at DESC").Order("id DESC").First(&review).Error; err != nil {
+			return err
+		}
+		if !review.HasUndoSnapshot {
+			return errNoUndoSnapshot
+		}
+		// A review of the card on another device holds this lock until it
+		// is saved, so it either waits for the undo or is caught below
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("Word").
+			Where("id = ? AND user_id = ?", review.CardID, user.ID).First(&card).Error; err != nil {
+			return err
+		}
+		if card.State != review.NewState || card.LearningStep != review.NewStep || !card.DueDate.Equal(review.NewDueDate) ||
+			card.IsSuspended != review.NewIsSuspended {
+			return errCardChanged
+		}
+		// Another undo may have taken the review while this one waited
+		result := tx.Delete(&models.ReviewHistory{}, review.ID)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errCardChanged
+		}
+
+		card.State = review.OldState
+		card.LearningStep = review.OldStep
+		card.IntervalDays = review.OldInterval
+		card.EaseFactor = review.OldEaseFactor
+		card.Stability = review.OldStability
+		card.Difficulty = review.OldDifficulty
+		card.DueDate = review.OldDueDate
+		card.RepetitionCount = review.OldRepetitions
+		card.Lapses = review.OldLapses
+		card.LastReviewedAt = review.OldLastReviewedAt
+		card.TotalReviews = max(card.TotalReviews-1, 0)
+		if srs.Grade(review.ResponseQuality).Passed() {
+			card.CorrectReviews = max(card.CorrectReviews-1, 0)
+		}
+		card.CurrentStreak = review.OldStreak
+		card.LongestStreak = review.OldLongestStreak
+		card.IsLeech = review.OldIsLeech
+		card.IsSuspended = review.OldIsSuspended
+		card.UndoneAt = &now
+		if err := restoreDeck(tx, &card, review.OldDeckID); err != nil {
+			return err
+		}
+		if err := tx.Omit("Word").Save(&card).Error; err != nil {
+			return err
+		}
+
+		// Siblings stay buried if another of them was studied that day
+		var others int64
+		err := tx.Model(&models.ReviewHistory{}).
+			Joins("JOIN srs_cards ON srs_cards.id = review_history.card_id").
+			Where("review_history.user_id = ? AND srs_cards.word_id = ? AND review_history.reviewed_at >= ?", user.ID, card.WordID, study.DayStart(review.ReviewedAt)).
+			Count(&others).Error
+		if err != nil || others > 0 {
+			return err
+		}
+		return cards.UnburySiblings(tx, &card, study.DayEnd(review.ReviewedAt))
+	})
+	switch {
+	case err == gorm.ErrRecordNotFound:
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Nothing to undo",
+		})
+		return
+	case err == errCardChanged:
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "Card has changed since the review",
+		})
+		return
+	case err == errNoUndoSnapshot:
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "Review cannot be undone",
+		})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to undo review",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"card":   DueCard{SRSCard: card, NextDue: nextDue(srs.Preview(srs.ForUser(user), card, now))},
+		"undone": review,
+	})
+}
+
+// errCardChanged is returned when undoing a review of a card that has
+// changed since
+var errCardChanged = errors.New("card has changed since the review")
+
+// errNoUndoSnapshot is returned when undoing a review recorded without the
+// pre-review card
+var errNoUndoSnapshot = errors.New("review has no undo snapshot")
+
+// restoreDeck gives a card the review sent home back to the filtered deck it
+// was in, if that still exists
+func restoreDeck(tx *gorm.DB, card *models.SRSCard, deckID *uint) error {
+	if deckID == nil || card.DeckID == nil || *deckID == *card.DeckID || card.OriginalDeckID != nil {
+		return nil
+	}
+	var deck models.Deck
+	err := tx.Where("id = ? AND user_id = ? AND is_filtered = ?", *deckID, card.UserID, true).First(&deck).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	card.OriginalDeckID = card.DeckID
+	card.DeckID = &deck.ID
+	return nil
+}
@@ -0,0 +1,296 @@
+package handlers
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+
+	"japanese-learning-app/internal/knowledge"
+	"japanese-learning-app/internal/models"
+	"japanese-learning-app/internal/processing"
+	"japanese-learning-app/internal/textproc"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Filters and orders for GetBookVocab
+const (
+	VocabStatusUnknown = "unknown"
+	VocabStatusKnown   = "known"
+	VocabStatusAll     = "all"
+
+	VocabSortFrequencyInBook = "frequency_in_book"
+	VocabSortFirstOccurrence = "first_occurrence"
+	VocabSortFrequency       = "frequency" // Global frequency rank
+)
+
+// VocabEntry is one word of a book's vocabulary list
+type VocabEntry struct {
+	WordID         uint             `json:"word_id"`
+	Word           string           `json:"word"`
+	Reading        string           `json:"reading"`
+	PartOfSpeech   string           `json:"part_of_speech"`
+	JLPTLevel      *int             `json:"jlpt_level"`
+	FrequencyRank  *int             `json:"frequency_rank"`
+	Occurrences    int              `json:"occurrences"`
+	FirstPosition  int              `json:"first_position"`
+	KnowledgeLevel int              `json:"knowledge_level"`
+	IsIgnored      bool             `json:"is_ignored"`
+	Example        *SentenceContext `json:"example"`
+	InSRS          bool             `json:"in_srs"`
+	AddToSRS       *AddToSRSAction  `json:"add_to_srs,omitempty"` // Absent once the word has a card
+}
+
+// AddToSRSAction is the request that adds a word to the user's SRS cards
+type AddToSRSAction struct {
+	Method string                   `json:"method"`
+	URL    string                   `json:"url"`
+	Body   models.CreateCardRequest `json:"body"`
+}
+
+// GetBookVocab lists the words of a book, or of one chapter with ?chapter=,
+// for pre-study. ?status= is unknown (default), known or all; ?sort= is
+// frequency_in_book (default), first_occurrence or frequency. Pages with
+// ?offset= and ?limit=.
+func (h *Handler) GetBookVocab(c *gin.Context) {
+	user, book, ok := h.loadUserBook(c)
+	if !ok {
+		return
+	}
+	if book.ProcessingStatus != processing.StatusCompleted {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "Book has not been analyzed yet",
+		})
+		return
+	}
+
+	status := c.DefaultQuery("status", VocabStatusUnknown)
+	if status != VocabStatusUnknown && status != VocabStatusKnown && status != VocabStatusAll {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "status must be unknown, known or all",
+		})
+		return
+	}
+	order := c.DefaultQuery("sort", VocabSortFrequencyInBook)
+	if order != VocabSortFrequencyInBook && order != VocabSortFirstOccurrence && order != VocabSortFrequency {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "sort must be frequency_in_book, first_occurrence or frequency",
+		})
+		return
+	}
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	offset = max(offset, 0)
+	limit = min(max(limit, 1), 1000)
+
+	var chapter *models.Chapter
+	if raw := c.Query("chapter"); raw != "" {
+		ch, ok := chapterByIndex(c, book, raw)
+		if !ok {
+			return
+		}
+		chapter = &ch
+	}
+
+	var rows []models.BookWord
+	var err error
+	if chapter != nil {
+		rows, err = h.chapterWords(book, *chapter)
+	} else {
+		err = h.db.Preload("Word").Where("book_id = ?", book.ID).Find(&rows).Error
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to fetch vocabulary",
+		})
+		return
+	}
+
+	ids := make([]uint, 0, len(rows))
+	for _, row := range rows {
+		ids = append(ids, row.WordID)
+	}
+	known, err := h.userKnowledge(user.ID, ids)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to load word knowledge",
+		})
+		return
+	}
+
+	entries := make([]VocabEntry, 0, len(rows))
+	for _, row := range rows {
+		k := known[row.WordID]
+		covered := knowledge.State{Level: k.KnowledgeLevel, Ignored: k.IsIgnored}.Covered()
+		if (status == VocabStatusUnknown && covered) || (status == VocabStatusKnown && !covered) {
+			continue
+		}
+		entries = append(entries, VocabEntry{
+			WordID:         row.WordID,
+			Word:           row.Word.SurfaceForm,
+			Reading:        row.Word.Reading,
+			PartOfSpeech:   row.Word.PartOfSpeech,
+			JLPTLevel:      row.Word.JLPTLevel,
+			FrequencyRank:  row.Word.FrequencyRank,
+			Occurrences:    row.Occurrences,
+			FirstPosition:  row.FirstPosition,
+			KnowledgeLevel: k.KnowledgeLevel,
+			IsIgnored:      k.IsIgnored,
+		})
+	}
+	sortVocab(entries, order)
+
+	total := len(entries)
+	entries = entries[min(offset, total):min(offset+limit, total)]
+	if err := h.fillVocabPage(user.ID, book, entries); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to fetch vocabulary",
+		})
+		return
+	}
+
+	response := gin.H{
+		"book_id": book.ID,
+		"status":  status,
+		"sort":    order,
+		"total":   total,
+		"offset":  offset,
+		"words":   entries,
+	}
+	if chapter != nil {
+		response["chapter"] = chapter
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// chapterWords counts the book's words within one chapter by tokenizing it,
+// in the same form as the book-wide book_words rows
+func (h *Handler) chapterWords(book *models.Book, chapter models.Chapter) ([]models.BookWord, error) {
+	type key struct{ form, reading string }
+	counts := make(map[key]*models.BookWord)
+	var forms []string
+	for _, tok := range h.tokenizeRange([]rune(book.ExtractedText), chapter.StartPos, chapter.EndPos) {
+		if !tok.IsWord() {
+			continue
+		}
+		k := key{tok.BaseForm, tok.BaseReading}
+		if bw, ok := counts[k]; ok {
+			bw.Occurrences++
+			continue
+		}
+		counts[k] = &models.BookWord{BookID: book.ID, Occurrences: 1, FirstPosition: tok.Start}
+		forms = append(forms, tok.BaseForm)
+	}
+	if len(forms) == 0 {
+		return nil, nil
+	}
+
+	// Only words recorded for the book, so the chapter list agrees with the
+	// book-wide one
+	var words []models.Word
+	err := h.db.Model(&models.Word{}).
+		Joins("JOIN book_words ON book_words.word_id = words.id AND book_words.book_id = ?", book.ID).
+		Where("words.surface_form IN ?", forms).
+		Find(&words).Error
+	if err != nil {
+		return nil, err
+	}
+
+	rows := make([]models.BookWord, 0, len(words))
+	for _, w := range words {
+		if bw, ok := counts[key{w.SurfaceForm, w.Reading}]; ok {
+			bw.WordID = w.ID
+			bw.Word = w
+			rows = append(rows, *bw)
+		}
+	}
+	return rows, nil
+}
+
+// userKnowledge loads the user's knowledge of the given words by word ID
+func (h *Handler) userKnowledge(userID uint, wordIDs []uint) (map[uint]models.UserWordKnowledge, error) {
+	known := make(map[uint]models.UserWordKnowledge, len(wordIDs))
+	for start := 0; start < len(wordIDs); start += 1000 {
+		var rows []models.UserWordKnowledge
+		chunk := wordIDs[start:min(start+1000, len(wordIDs))]
+		if err := h.db.Where("user_id = ? AND word_id IN ?", userID, chunk).Find(&rows).Error; err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			known[row.WordID] = row
+		}
+	}
+	return known, nil
+}
+
+// fillVocabPage adds example sentences and SRS state to a page of entries
+func (h *Handler) fillVocabPage(userID uint, book *models.Book, entries []VocabEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	var rows []models.BookSentence
+	if err := h.db.Select("sentence_index", "start_position", "end_position").
+		Where("book_id = ?", book.ID).Order("sentence_index").Find(&rows).Error; err != nil {
+		return err
+	}
+	sentences := make([]textproc.Sentence, len(rows))
+	for i, row := range rows {
+		sentences[i] = textproc.Sentence{Start: row.StartPosition, End: row.EndPosition}
+	}
+
+	ids := make([]uint, len(entries))
+	for i, e := range entries {
+		ids[i] = e.WordID
+	}
+	var carded []uint
+	if err := h.db.Model(&models.SRSCard{}).Where("user_id = ? AND word_id IN ?", userID, ids).
+		Distinct().Pluck("word_id", &carded).Error; err != nil {
+		return err
+	}
+	inSRS := make(map[uint]bool, len(carded))
+	for _, id := range carded {
+		inSRS[id] = true
+	}
+
+	text := []rune(book.ExtractedText)
+	for i := range entries {
+		e := &entries[i]
+		if n := textproc.SentenceAt(sentences, e.FirstPosition); n >= 0 {
+			example := sentenceContext(text, rows[n])
+			e.Example = &example
+		}
+		e.InSRS = inSRS[e.WordID]
+		if !e.InSRS {
+			bookID, position := book.ID, e.FirstPosition
+			e.AddToSRS = &AddToSRSAction{
+				Method: http.MethodPost,
+				URL:    "/api/srs/cards",
+				Body:   models.CreateCardRequest{WordID: e.WordID, BookID: &bookID, Position: &position},
+			}
+		}
+	}
+	return nil
+}
+
+// sortVocab orders entries; ties fall back to the first occurrence
+func sortVocab(entries []VocabEntry, order string) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		switch order {
+		case VocabSortFrequencyInBook:
+			if a.Occurrences != b.Occurrences {
+				return a.Occurrences > b.Occurrences
+			}
+		case VocabSortFrequency:
+			// Words without a rank go last
+			if (a.FrequencyRank == nil) != (b.FrequencyRank == nil) {
+				return a.FrequencyRank != nil
+			}
+			if a.FrequencyRank != nil && *a.FrequencyRank != *b.FrequencyRank {
+				return *a.FrequencyRank < *b.FrequencyRank
+			}
+		}
+		return a.FirstPosition < b.FirstPosition
+	})
+}
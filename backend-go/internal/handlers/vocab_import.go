@@ -0,0 +1,223 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"japanese-learning-app/internal/knowledge"
+	"japanese-learning-app/internal/middleware"
+	"japanese-learning-app/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Import formats for ImportKnownWords
+const (
+	ImportFormatList = "list"
+	ImportFormatAnki = "anki"
+	ImportFormatJLPT = "jlpt"
+)
+
+// Import limits
+const (
+	maxImportSize  = 10 << 20
+	maxImportWords = 50000
+)
+
+// ImportKnownWords marks a batch of words the user already knows. The
+// multipart form takes a "format":
+//
+//	list  a word per line, optionally followed by its reading ("file" or "text")
+//	anki  an Anki plain text export ("file"); "field" is the 1-based column
+//	      with the word and "reading_field" optionally the one with its reading
+//	jlpt  every word of JLPT "level" (5 = N5 ... 1 = N1) and the easier levels
+//
+// Words are raised to "knowledge_level" (default known); levels the user
+// already has above it are kept. Words that match no entry or several
+// entries are reported back and left alone.
+func (h *Handler) ImportKnownWords(c *gin.Context) {
+	user, err := middleware.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "User not found",
+		})
+		return
+	}
+
+	level := models.KnowledgeKnown
+	if raw := c.PostForm("knowledge_level"); raw != "" {
+		level, err = strconv.Atoi(raw)
+		if err != nil || level < models.KnowledgeUnknown || level > models.KnowledgeMastered {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "knowledge_level must be between 0 and 4",
+			})
+			return
+		}
+	}
+
+	format := c.PostForm("format")
+	var refs []models.WordRef
+	switch format {
+	case ImportFormatList, ImportFormatAnki:
+		refs, err = h.parseImport(c, format)
+	case ImportFormatJLPT:
+		var jlpt int
+		if jlpt, err = parseJLPTLevel(c.PostForm("level")); err == nil {
+			if refs, err = h.jlptPreset(jlpt); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"error": "Failed to add JLPT words",
+				})
+				return
+			}
+		}
+	default:
+		err = fmt.Errorf("format must be one of %s, %s or %s", ImportFormatList, ImportFormatAnki, ImportFormatJLPT)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	refs = knowledge.Dedupe(refs)
+	if len(refs) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "No words found in import",
+		})
+		return
+	}
+	if len(refs) > maxImportWords {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("Imports are limited to %d words", maxImportWords),
+		})
+		return
+	}
+
+	total := len(refs)
+	unmatched := []models.WordRef{}
+	ambiguous := []knowledge.Match{}
+	imported := 0
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		matches, err := knowledge.Resolve(tx, refs)
+		if err != nil {
+			return err
+		}
+		var ids []uint
+		for _, m := range matches {
+			switch {
+			case m.Resolved():
+				ids = append(ids, m.WordID)
+			case m.Ambiguous():
+				ambiguous = append(ambiguous, m)
+			default:
+				unmatched = append(unmatched, m.Ref)
+			}
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+		changes, err := knowledge.Apply(tx, user.ID, ids, knowledge.Update{Level: &level, RaiseOnly: true})
+		imported = len(changes)
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to import words",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"total":               total,
+		"imported":            imported,
+		"unmatched":           unmatched,
+		"ambiguous":           ambiguous,
+		"total_words_learned": h.totalWordsLearned(user.ID),
+	})
+}
+
+// parseImport reads an uploaded list or Anki export
+func (h *Handler) parseImport(c *gin.Context, format string) ([]models.WordRef, error) {
+	var r io.Reader
+	if header, err := c.FormFile("file"); err == nil {
+		if header.Size > maxImportSize {
+			return nil, fmt.Errorf("file is larger than %d MB", maxImportSize>>20)
+		}
+		f, err := header.Open()
+		if err != nil {
+			return nil, errors.New("failed to read uploaded file")
+		}
+		defer f.Close()
+		r = io.LimitReader(f, maxImportSize)
+	} else if text := c.PostForm("text"); text != "" && format == ImportFormatList {
+		r = strings.NewReader(text)
+	} else {
+		return nil, errors.New("no file uploaded")
+	}
+
+	if format == ImportFormatList {
+		return knowledge.ParseList(r)
+	}
+
+	field, err := strconv.Atoi(c.DefaultPostForm("field", "1"))
+	if err != nil || field < 1 {
+		return nil, errors.New("field must be a column number starting at 1")
+	}
+	readingField := 0
+	if raw := c.PostForm("reading_field"); raw != "" {
+		readingField, err = strconv.Atoi(raw)
+		if err != nil || readingField < 1 {
+			return nil, errors.New("reading_field must be a column number starting at 1")
+		}
+	}
+	return knowledge.ParseAnkiTSV(r, field, readingField)
+}
+
+// parseJLPTLevel parses a JLPT level such as "N3" or "3"
+func parseJLPTLevel(raw string) (int, error) {
+	level, err := strconv.Atoi(strings.TrimPrefix(strings.ToUpper(raw), "N"))
+	if err != nil || level < 1 || level > 5 {
+		return 0, errors.New("level must be a JLPT level from 5 (N5) to 1 (N1)")
+	}
+	return level, nil
+}
+
+// jlptPreset lists the words of a JLPT level and every easier level. Listed
+// words missing from the dictionary are added, so that a preset does not
+// depend on which books have been analyzed.
+func (h *Handler) jlptPreset(level int) ([]models.WordRef, error) {
+	var refs []models.WordRef
+	var missing []models.Word
+	for l := 5; l >= level; l-- {
+		for _, entry := range h.lists.JLPTEntries(l) {
+			refs = append(refs, models.WordRef{Word: entry.Word, Reading: entry.Reading})
+			if entry.Reading != "" {
+				jlpt := l
+				missing = append(missing, models.Word{
+					SurfaceForm: entry.Word,
+					Reading:     entry.Reading,
+					BaseForm:    entry.Word,
+					JLPTLevel:   &jlpt,
+				})
+			}
+		}
+	}
+
+	if len(missing) > 0 {
+		err := h.db.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "surface_form"}, {Name: "reading"}},
+			DoNothing: true,
+		}).CreateInBatches(missing, 1000).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+	return refs, nil
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"unicode/utf8"
+
+	"japanese-learning-app/internal/dictionary"
+	"japanese-learning-app/internal/knowledge"
+	"japanese-learning-app/internal/middleware"
+	"japanese-learning-app/internal/textproc"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxLookupLength bounds lookup queries; longer selections are not words
+const maxLookupLength = 100
+
+// LookupWord looks a word up in the local dictionaries, falling back to
+// Jisho when they have no match. Passing ?book_id= and ?position= adds the
+// sentence the word was found in; ?reading= picks the entry the lookup counts
+// as an encounter of.
+func (h *Handler) LookupWord(c *gin.Context) {
+	word := c.Param("word")
+	if word == "" || utf8.RuneCountInString(word) > maxLookupLength {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid word",
+		})
+		return
+	}
+
+	result, err := h.dictionary.Lookup(c.Request.Context(), word)
+	if result == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to look up word",
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("Dictionary fallback failed for %q: %v", word, err)
+		if len(result.Entries) == 0 {
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"error": "Dictionary service unavailable",
+			})
+			return
+		}
+	}
+
+	h.countLookup(c, result)
+
+	response := gin.H{
+		"word":    word,
+		"query":   result.Query,
+		"source":  result.Source,
+		"entries": result.Entries,
+	}
+	// Include the surrounding sentence when the lookup comes from the reader
+	if sentence := h.lookupContext(c); sentence != nil {
+		response["sentence"] = sentence
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// countLookup counts the lookup as an encounter of the word looked up, if
+// the user already tracks it. Of homographs only the one with the given
+// reading counts. A failure only costs the count, so it is logged.
+func (h *Handler) countLookup(c *gin.Context, result *dictionary.Result) {
+	user, err := middleware.GetCurrentUser(c)
+	if err != nil {
+		return
+	}
+	reading := textproc.ToHiragana(textproc.NormalizeString(c.Query("reading")))
+	var ids []uint
+	for _, e := range result.Entries {
+		if e.WordID != nil && e.Word == result.Query && (reading == "" || e.Reading == reading) {
+			ids = append(ids, *e.WordID)
+		}
+	}
+	if len(ids) != 1 {
+		return
+	}
+	if err := knowledge.Encounter(h.db, user.ID, ids); err != nil {
+		log.Printf("Failed to count lookup: %v", err)
+	}
+}
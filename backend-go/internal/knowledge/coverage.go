@@ -0,0 +1,117 @@
+package knowledge
+
+import (
+	"fmt"
+
+	"japanese-learning-app/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// Covered reports whether a word counts as understood for book coverage.
+// Ignored words (names, noise) count, so they do not drag coverage down.
+func (s State) Covered() bool {
+	return s.Ignored || s.Level >= models.KnowledgeKnown
+}
+
+// coveredCondition selects user_word_knowledge rows for which Covered holds
+const coveredCondition = "(k.is_ignored = ? OR k.knowledge_level >= ?)"
+
+// RecomputeCoverage counts from scratch how much of a book its owner knows.
+// Call it after the book's words have been (re)written.
+func RecomputeCoverage(tx *gorm.DB, bookID, userID uint) error {
+	var counts struct {
+		Tokens int
+		Words  int
+	}
+	err := tx.Table("book_words AS bw").
+		Select("COALESCE(SUM(bw.occurrences), 0) AS tokens, COUNT(*) AS words").
+		Joins("JOIN user_word_knowledge AS k ON k.word_id = bw.word_id AND k.user_id = ?", userID).
+		Where("bw.book_id = ? AND "+coveredCondition, bookID, true, models.KnowledgeKnown).
+		Scan(&counts).Error
+	if err != nil {
+		return fmt.Errorf("failed to compute coverage of book %d: %w", bookID, err)
+	}
+
+	err = tx.Model(&models.Book{}).Where("id = ?", bookID).Updates(map[string]interface{}{
+		"known_word_count":        counts.Tokens,
+		"known_unique_word_count": counts.Words,
+	}).Error
+	if err != nil {
+		return fmt.Errorf("failed to update coverage of book %d: %w", bookID, err)
+	}
+	return nil
+}
+
+// updateCoverage adjusts the coverage of the user's books for words that
+// became known or stopped being known, without recounting whole books
+func updateCoverage(tx *gorm.DB, userID uint, changes []Change) error {
+	sign := make(map[uint]int)
+	var ids []uint
+	for _, ch := range changes {
+		before, after := ch.Before.Covered(), ch.After.Covered()
+		switch {
+		case after && !before:
+			sign[ch.WordID] = 1
+		case before && !after:
+			sign[ch.WordID] = -1
+		default:
+			continue
+		}
+		ids = append(ids, ch.WordID)
+	}
+
+	type delta struct{ tokens, words int }
+	deltas := make(map[uint]*delta)
+	for start := 0; start < len(ids); start += batchSize {
+		var rows []models.BookWord
+		chunk := ids[start:min(start+batchSize, len(ids))]
+		err := tx.Table("book_words").
+			Select("book_words.book_id, book_words.word_id, book_words.occurrences").
+			Joins("JOIN books ON books.id = book_words.book_id").
+			Where("books.user_id = ? AND books.deleted_at IS NULL AND book_words.word_id IN ?", userID, chunk).
+			Scan(&rows).Error
+		if err != nil {
+			return fmt.Errorf("failed to load book words: %w", err)
+		}
+		for _, row := range rows {
+			d := deltas[row.BookID]
+			if d == nil {
+				d = &delta{}
+				deltas[row.BookID] = d
+			}
+			d.tokens += sign[row.WordID] * row.Occurrences
+			d.words += sign[row.WordID]
+		}
+	}
+
+	for bookID, d := range deltas {
+		if d.tokens == 0 && d.words == 0 {
+			continue
+		}
+		err := tx.Model(&models.Book{}).Where("id = ?", bookID).Updates(map[string]interface{}{
+			"known_word_count":        gorm.Expr("known_word_count + ?", d.tokens),
+			"known_unique_word_count": gorm.Expr("known_unique_word_count + ?", d.words),
+		}).Error
+		if err != nil {
+			return fmt.Errorf("failed to update coverage of book %d: %w", bookID, err)
+		}
+	}
+	return nil
+}
+
+// CoveredWords returns the IDs of the words Covered for the user
+func CoveredWords(tx *gorm.DB, userID uint) (map[uint]bool, error) {
+	var ids []uint
+	err := tx.Table("user_word_knowledge AS k").
+		Where("k.user_id = ? AND "+coveredCondition, userID, true, models.KnowledgeKnown).
+		Pluck("k.word_id", &ids).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to load known words: %w", err)
+	}
+	covered := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		covered[id] = true
+	}
+	return covered, nil
+}
@@ -0,0 +1,133 @@
+package knowledge
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"io"
+	"regexp"
+	"strings"
+
+	"japanese-learning-app/internal/models"
+	"japanese-learning-app/internal/textproc"
+)
+
+// maxImportLine bounds a single line of an imported file
+const maxImportLine = 1 << 20
+
+var (
+	htmlTag   = regexp.MustCompile(`<[^>]*>`)
+	ankiSound = regexp.MustCompile(`\[sound:[^\]]*\]`)
+	// Anki furigana syntax: 食[た]べる, with an optional space before the
+	// base to mark where it starts
+	ankiRuby = regexp.MustCompile(` ?([^ \[\]]+)\[([^\[\]]*)\]`)
+)
+
+// ParseList reads a plain word list: one word per line, optionally followed
+// by a tab or space and the reading. Blank lines and '#' comments are skipped.
+func ParseList(r io.Reader) ([]models.WordRef, error) {
+	var refs []models.WordRef
+	err := scanLines(r, func(line string) {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			return
+		}
+		ref := models.WordRef{Word: fields[0]}
+		if len(fields) > 1 {
+			ref.Reading = fields[1]
+		}
+		refs = append(refs, ref)
+	})
+	return refs, err
+}
+
+// ParseAnkiTSV reads an Anki "Notes in Plain Text" export. field is the
+// 1-based column holding the word; readingField, if non-zero, the column
+// holding its reading. HTML and sound tags are stripped, and a word written
+// with Anki furigana (食[た]べる) yields both its form and reading.
+func ParseAnkiTSV(r io.Reader, field, readingField int) ([]models.WordRef, error) {
+	if field < 1 {
+		return nil, fmt.Errorf("invalid field %d", field)
+	}
+
+	var refs []models.WordRef
+	err := scanLines(r, func(line string) {
+		// Newer exports start with "#separator:tab"-style headers
+		if strings.HasPrefix(line, "#") {
+			return
+		}
+		columns := strings.Split(line, "\t")
+		if len(columns) < field {
+			return
+		}
+		word, reading := ankiField(columns[field-1])
+		if readingField > 0 && readingField <= len(columns) {
+			reading, _ = ankiField(columns[readingField-1])
+		}
+		if word != "" {
+			refs = append(refs, models.WordRef{Word: word, Reading: reading})
+		}
+	})
+	return refs, err
+}
+
+// ankiField cleans up one field of an Anki export, returning the written
+// form and, if the field used furigana syntax, the reading
+func ankiField(s string) (word, reading string) {
+	s = strings.Trim(s, `"`)
+	s = strings.ReplaceAll(s, `""`, `"`)
+	return AnkiWord(s)
+}
+
+// AnkiText strips the HTML and sound tags from an Anki note field
+func AnkiText(s string) string {
+	s = ankiSound.ReplaceAllString(s, "")
+	s = htmlTag.ReplaceAllString(s, "")
+	s = strings.ReplaceAll(s, "&nbsp;", " ")
+	return strings.TrimSpace(html.UnescapeString(s))
+}
+
+// AnkiWord reads the word in an Anki note field, returning the written form
+// and, if the field used furigana syntax, the reading
+func AnkiWord(s string) (word, reading string) {
+	s = AnkiText(s)
+	if !ankiRuby.MatchString(s) {
+		return s, ""
+	}
+	word = strings.TrimSpace(ankiRuby.ReplaceAllString(s, "$1"))
+	reading = strings.TrimSpace(ankiRuby.ReplaceAllString(s, "$2"))
+	reading = strings.ReplaceAll(reading, " ", "")
+	if textproc.ContainsKanji(reading) {
+		// Only part of the field had furigana
+		reading = ""
+	}
+	return strings.ReplaceAll(word, " ", ""), reading
+}
+
+func scanLines(r io.Reader, fn func(line string)) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxImportLine)
+	for scanner.Scan() {
+		line := strings.TrimSpace(strings.TrimPrefix(scanner.Text(), "\ufeff"))
+		if line != "" {
+			fn(line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read import: %w", err)
+	}
+	return nil
+}
+
+// Dedupe drops repeated references, keeping the first of each
+func Dedupe(refs []models.WordRef) []models.WordRef {
+	seen := make(map[models.WordRef]bool, len(refs))
+	out := refs[:0]
+	for _, ref := range refs {
+		if !seen[ref] {
+			seen[ref] = true
+			out = append(out, ref)
+		}
+	}
+	return out
+}
@@ -0,0 +1,197 @@
+package knowledge
+
+import (
+	"fmt"
+
+	"japanese-learning-app/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// batchSize bounds IN lists and batched inserts
+const batchSize = 1000
+
+// Update describes the fields to set on a user's knowledge of some words.
+// Nil fields are left alone on existing rows and take their defaults on new
+// ones.
+type Update struct {
+	Level           *int
+	RaiseOnly       bool // Never lower an existing level
+	Ignored         *bool
+	Notes           *string
+	FirstSeenBookID *uint
+	Encountered     bool // The user met the word, e.g. marked it while reading
+}
+
+// State is the part of a knowledge row that decides whether a word counts
+// as known
+type State struct {
+	Level   int
+	Ignored bool
+}
+
+// Change records how one word's state moved
+type Change struct {
+	WordID uint
+	Before State // zero value if the user had no row for the word
+	After  State
+}
+
+// Learned reports whether a word counts towards User.TotalWordsLearned
+func (s State) Learned() bool {
+	return !s.Ignored && s.Level >= models.KnowledgeKnown
+}
+
+// Apply sets the update on the user's knowledge of each word, creating rows
+// for words seen for the first time, and keeps User.TotalWordsLearned and
+// the coverage of the user's books in step. Run it inside a transaction.
+func Apply(tx *gorm.DB, userID uint, wordIDs []uint, u Update) ([]Change, error) {
+	wordIDs = unique(wordIDs)
+	changes := make([]Change, 0, len(wordIDs))
+
+	// Updates of the same user's words wait for each other, so the rows read
+	// here are still current when written and every change is counted once
+	var user models.User
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&user, userID).Error; err != nil {
+		return nil, fmt.Errorf("failed to lock user: %w", err)
+	}
+
+	existing := make(map[uint]models.UserWordKnowledge, len(wordIDs))
+	for start := 0; start < len(wordIDs); start += batchSize {
+		var rows []models.UserWordKnowledge
+		chunk := wordIDs[start:min(start+batchSize, len(wordIDs))]
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("user_id = ? AND word_id IN ?", userID, chunk).Find(&rows).Error
+		if err != nil {
+			return nil, fmt.Errorf("failed to load word knowledge: %w", err)
+		}
+		for _, row := range rows {
+			existing[row.WordID] = row
+		}
+	}
+
+	var created []models.UserWordKnowledge
+	var updated []uint
+	for _, id := range wordIDs {
+		row, ok := existing[id]
+		if !ok {
+			row = models.UserWordKnowledge{UserID: userID, WordID: id}
+			row.FirstSeenBookID = u.FirstSeenBookID
+			if u.Encountered {
+				row.TimesEncountered = 1
+			}
+		}
+		change := Change{WordID: id}
+		if ok {
+			change.Before = State{Level: row.KnowledgeLevel, Ignored: row.IsIgnored}
+		}
+		if u.Level != nil && (!u.RaiseOnly || *u.Level > row.KnowledgeLevel) {
+			row.KnowledgeLevel = *u.Level
+		}
+		if u.Ignored != nil {
+			row.IsIgnored = *u.Ignored
+		}
+		if u.Notes != nil {
+			row.Notes = *u.Notes
+		}
+		change.After = State{Level: row.KnowledgeLevel, Ignored: row.IsIgnored}
+		changes = append(changes, change)
+
+		if ok {
+			updated = append(updated, id)
+		} else {
+			created = append(created, row)
+		}
+	}
+
+	if len(created) > 0 {
+		// No row can appear meanwhile, so a conflict is an error rather than
+		// a change reported but never made
+		if err := tx.CreateInBatches(created, batchSize).Error; err != nil {
+			return nil, fmt.Errorf("failed to create word knowledge: %w", err)
+		}
+	}
+
+	fields := make(map[string]interface{})
+	if u.Level != nil && u.RaiseOnly {
+		fields["knowledge_level"] = gorm.Expr("CASE WHEN knowledge_level < ? THEN ? ELSE knowledge_level END", *u.Level, *u.Level)
+	} else if u.Level != nil {
+		fields["knowledge_level"] = *u.Level
+	}
+	if u.Ignored != nil {
+		fields["is_ignored"] = *u.Ignored
+	}
+	if u.Notes != nil {
+		fields["notes"] = *u.Notes
+	}
+	if u.Encountered {
+		fields["times_encountered"] = gorm.Expr("times_encountered + 1")
+	}
+	if u.FirstSeenBookID != nil {
+		// Only fills in a missing first-seen book; the first one sticks
+		fields["first_seen_book_id"] = gorm.Expr("COALESCE(first_seen_book_id, ?)", *u.FirstSeenBookID)
+	}
+	if len(updated) > 0 && len(fields) > 0 {
+		for start := 0; start < len(updated); start += batchSize {
+			chunk := updated[start:min(start+batchSize, len(updated))]
+			err := tx.Model(&models.UserWordKnowledge{}).
+				Where("user_id = ? AND word_id IN ?", userID, chunk).
+				Updates(fields).Error
+			if err != nil {
+				return nil, fmt.Errorf("failed to update word knowledge: %w", err)
+			}
+		}
+	}
+
+	if err := updateCoverage(tx, userID, changes); err != nil {
+		return nil, err
+	}
+	if err := RecountLearned(tx, userID); err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+// Encounter counts an encounter, such as a lookup, of each word on the
+// user's existing knowledge rows. Words without a row are left alone.
+func Encounter(tx *gorm.DB, userID uint, wordIDs []uint) error {
+	wordIDs = unique(wordIDs)
+	for start := 0; start < len(wordIDs); start += batchSize {
+		chunk := wordIDs[start:min(start+batchSize, len(wordIDs))]
+		err := tx.Model(&models.UserWordKnowledge{}).
+			Where("user_id = ? AND word_id IN ?", userID, chunk).
+			Update("times_encountered", gorm.Expr("times_encountered + 1")).Error
+		if err != nil {
+			return fmt.Errorf("failed to count word encounters: %w", err)
+		}
+	}
+	return nil
+}
+
+// RecountLearned recomputes User.TotalWordsLearned from the knowledge table
+func RecountLearned(tx *gorm.DB, userID uint) error {
+	var learned int64
+	err := tx.Model(&models.UserWordKnowledge{}).
+		Where("user_id = ? AND knowledge_level >= ? AND is_ignored = ?", userID, models.KnowledgeKnown, false).
+		Count(&learned).Error
+	if err != nil {
+		return fmt.Errorf("failed to count learned words: %w", err)
+	}
+	if err := tx.Model(&models.User{}).Where("id = ?", userID).Update("total_words_learned", learned).Error; err != nil {
+		return fmt.Errorf("failed to update learned words: %w", err)
+	}
+	return nil
+}
+
+func unique(ids []uint) []uint {
+	seen := make(map[uint]bool, len(ids))
+	out := make([]uint, 0, len(ids))
+	for _, id := range ids {
+		if id != 0 && !seen[id] {
+			seen[id] = true
+			out = append(out, id)
+		}
+	}
+	return out
+}
@@ -0,0 +1,135 @@
+package knowledge
+
+import (
+	"fmt"
+
+	"japanese-learning-app/internal/models"
+	"japanese-learning-app/internal/textproc"
+
+	"gorm.io/gorm"
+)
+
+// Match is the outcome of resolving one word reference
+type Match struct {
+	Ref        models.WordRef `json:"ref"`
+	WordID     uint           `json:"word_id,omitempty"`    // 0 if unresolved
+	Candidates []models.Word  `json:"candidates,omitempty"` // Set when the reference is ambiguous
+}
+
+// Resolved reports whether the reference matched exactly one word
+func (m Match) Resolved() bool {
+	return m.WordID != 0
+}
+
+// Ambiguous reports whether the reference matched several words
+func (m Match) Ambiguous() bool {
+	return m.WordID == 0 && len(m.Candidates) > 0
+}
+
+// Resolve matches references to dictionary entries. A reference with an ID
+// must name an existing word; one with a form matches on the normalized form
+// and, if given, the reading in hiragana; a kana-only form that matches no
+// entry is tried as a reading. Results are in the order of refs.
+func Resolve(tx *gorm.DB, refs []models.WordRef) ([]Match, error) {
+	var ids []uint
+	var forms []string
+	// A form is loaded once, or words of a form listed in two batches would
+	// be found twice
+	seen := make(map[string]bool)
+	for i := range refs {
+		if refs[i].WordID != 0 {
+			ids = append(ids, refs[i].WordID)
+			continue
+		}
+		refs[i].Word = textproc.NormalizeString(refs[i].Word)
+		refs[i].Reading = textproc.ToHiragana(textproc.NormalizeString(refs[i].Reading))
+		if refs[i].Word != "" && !seen[refs[i].Word] {
+			seen[refs[i].Word] = true
+			forms = append(forms, refs[i].Word)
+		}
+	}
+
+	known := make(map[uint]bool)
+	for start := 0; start < len(ids); start += batchSize {
+		var found []uint
+		chunk := ids[start:min(start+batchSize, len(ids))]
+		if err := tx.Model(&models.Word{}).Where("id IN ?", chunk).Pluck("id", &found).Error; err != nil {
+			return nil, fmt.Errorf("failed to load words: %w", err)
+		}
+		for _, id := range found {
+			known[id] = true
+		}
+	}
+
+	byForm := make(map[string][]models.Word)
+	for start := 0; start < len(forms); start += batchSize {
+		var words []models.Word
+		chunk := forms[start:min(start+batchSize, len(forms))]
+		if err := tx.Where("surface_form IN ?", chunk).Order("id").Find(&words).Error; err != nil {
+			return nil, fmt.Errorf("failed to load words: %w", err)
+		}
+		for _, w := range words {
+			byForm[w.SurfaceForm] = append(byForm[w.SurfaceForm], w)
+		}
+	}
+
+	// Words given in kana only may be written with kanji in the dictionary;
+	// fall back to matching them by reading
+	var kanaOnly []string
+	seenReadings := make(map[string]bool)
+	for _, ref := range refs {
+		if ref.WordID == 0 && ref.Word != "" && len(byForm[ref.Word]) == 0 && isKana(ref.Word) {
+			if reading := textproc.ToHiragana(ref.Word); !seenReadings[reading] {
+				seenReadings[reading] = true
+				kanaOnly = append(kanaOnly, reading)
+			}
+		}
+	}
+	byReading := make(map[string][]models.Word)
+	for start := 0; start < len(kanaOnly); start += batchSize {
+		var words []models.Word
+		chunk := kanaOnly[start:min(start+batchSize, len(kanaOnly))]
+		if err := tx.Where("reading IN ?", chunk).Order("id").Find(&words).Error; err != nil {
+			return nil, fmt.Errorf("failed to load words: %w", err)
+		}
+		for _, w := range words {
+			byReading[w.Reading] = append(byReading[w.Reading], w)
+		}
+	}
+
+	matches := make([]Match, len(refs))
+	for i, ref := range refs {
+		matches[i].Ref = ref
+		if ref.WordID != 0 {
+			if known[ref.WordID] {
+				matches[i].WordID = ref.WordID
+			}
+			continue
+		}
+
+		var candidates []models.Word
+		for _, w := range byForm[ref.Word] {
+			if ref.Reading == "" || w.Reading == ref.Reading {
+				candidates = append(candidates, w)
+			}
+		}
+		if len(byForm[ref.Word]) == 0 {
+			candidates = byReading[textproc.ToHiragana(ref.Word)]
+		}
+		if len(candidates) == 1 {
+			matches[i].WordID = candidates[0].ID
+		} else {
+			matches[i].Candidates = candidates
+		}
+	}
+	return matches, nil
+}
+
+func isKana(s string) bool {
+	for _, r := range s {
+		if !textproc.IsKana(r) {
+			return false
+		}
+	}
+	return true
+}
@@ -1,7 +1,10 @@
 package models
 
 import (
+	"encoding/json"
+	"math"
 	"time"
+	"unicode/utf8"
 
 	"gorm.io/gorm"
 )
@@ -34,6 +37,14 @@ type Book struct {
 	UniqueWordCount  int    `json:"unique_word_count" gorm:"default:0"`
 	DifficultyLevel  string `json:"difficulty_level" gorm:"size:10"` // beginner, intermediate, advanced
 
+	// Owner's vocabulary coverage: word tokens and distinct words they know.
+	// Adjusted as their knowledge changes, recomputed when the book is analyzed.
+	KnownWordCount       int `json:"known_word_count" gorm:"default:0"`
+	KnownUniqueWordCount int `json:"known_unique_word_count" gorm:"default:0"`
+
+	// Signals behind DifficultyLevel, filled in when the book is analyzed
+	DifficultyProfile *DifficultyProfile `json:"difficulty_profile" gorm:"serializer:json"`
+
 	// Reading progress
 	LastReadAt      *time.Time `json:"last_read_at"`
 	ReadingProgress float64    `json:"reading_progress" gorm:"type:decimal(5,2);default:0.00"` // percentage
@@ -41,6 +52,7 @@ type Book struct {
 	// Content extraction
 	ExtractedText string                 `json:"extracted_text" gorm:"type:text"`
 	ChapterData   []map[string]interface{} `json:"chapter_data" gorm:"serializer:json"` // [{title, start_pos, end_pos}]
+	RubyData      []RubyAnnotation         `json:"ruby_data" gorm:"serializer:json"`    // Author-provided furigana
 
 	// Timestamps
 	UploadedAt time.Time `json:"uploaded_at" gorm:"autoCreateTime"`
@@ -55,6 +67,143 @@ func (Book) TableName() string {
 	return "books"
 }
 
+// Difficulty levels for Book.DifficultyLevel
+const (
+	DifficultyBeginner     = "beginner"
+	DifficultyIntermediate = "intermediate"
+	DifficultyAdvanced     = "advanced"
+)
+
+// DifficultyProfile holds the signals a difficulty estimate is built from
+type DifficultyProfile struct {
+	Score float64 `json:"score"` // 0-100
+	Level string  `json:"level"` // beginner, intermediate, advanced
+
+	// Share of word tokens harder than each JLPT level, keyed n5 ... n1.
+	// Words on no list count as beyond N1. Empty without JLPT lists.
+	JLPTBeyond map[string]float64 `json:"jlpt_beyond,omitempty"`
+
+	MedianFrequencyRank   *int    `json:"median_frequency_rank,omitempty"`
+	KanjiDensity          float64 `json:"kanji_density"`           // Kanji per non-space character
+	AverageSentenceLength float64 `json:"average_sentence_length"` // In characters
+	UniqueWordRatio       float64 `json:"unique_word_ratio"`       // Moving-average type/token ratio
+
+	// Each signal scaled to 0-1 (1 = hardest); signals without data are left out
+	SubScores map[string]float64 `json:"sub_scores"`
+}
+
+// RubyAnnotation is a reading the book's author attached to a span of text.
+// Positions are character offsets into ExtractedText.
+type RubyAnnotation struct {
+	StartPos int    `json:"start_pos"`
+	EndPos   int    `json:"end_pos"`
+	Reading  string `json:"reading"`
+}
+
+// ChapterProfile describes the vocabulary and difficulty of one chapter. It
+// is stored under the "profile" key of the chapter's ChapterData entry.
+type ChapterProfile struct {
+	WordCount               int     `json:"word_count"`
+	UniqueWords             int     `json:"unique_words"`
+	NewWords                int     `json:"new_words"`     // Words not seen in earlier chapters
+	KanjiDensity            float64 `json:"kanji_density"` // Kanji per non-space character
+	CharacterCount          int     `json:"character_count"`
+	EstimatedReadingMinutes float64 `json:"estimated_reading_minutes"`
+	DifficultyScore         float64 `json:"difficulty_score"` // 0-100, same scale as the book's
+	DifficultyLevel         string  `json:"difficulty_level"`
+}
+
+// Chapter is a typed view of a ChapterData entry
+type Chapter struct {
+	Index    int             `json:"index"`
+	Title    string          `json:"title"`
+	StartPos int             `json:"start_pos"`
+	EndPos   int             `json:"end_pos"`
+	Profile  *ChapterProfile `json:"profile,omitempty"`
+}
+
+// Chapters returns the book's chapters with positions clamped to the
+// extracted text. A book without chapter data is one chapter spanning the
+// whole text.
+func (b *Book) Chapters() []Chapter {
+	textLen := utf8.RuneCountInString(b.ExtractedText)
+	if len(b.ChapterData) == 0 {
+		return []Chapter{{Index: 0, Title: b.Title, StartPos: 0, EndPos: textLen}}
+	}
+
+	chapters := make([]Chapter, 0, len(b.ChapterData))
+	for i, data := range b.ChapterData {
+		chapter := Chapter{Index: i}
+		chapter.Title, _ = data["title"].(string)
+		chapter.StartPos = min(max(intValue(data["start_pos"]), 0), textLen)
+		chapter.EndPos = min(max(intValue(data["end_pos"]), chapter.StartPos), textLen)
+		chapter.Profile = chapterProfile(data["profile"])
+		chapters = append(chapters, chapter)
+	}
+	return chapters
+}
+
+// chapterProfile reads a stored profile, which comes back from the database
+// as a generic JSON object
+func chapterProfile(v interface{}) *ChapterProfile {
+	switch p := v.(type) {
+	case nil:
+		return nil
+	case *ChapterProfile:
+		return p
+	case ChapterProfile:
+		return &p
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	var profile ChapterProfile
+	if err := json.Unmarshal(raw, &profile); err != nil {
+		return nil
+	}
+	return &profile
+}
+
+// intValue reads a number out of a JSON-decoded value
+func intValue(v interface{}) int {
+	switch n := v.(type) {
+	case float64:
+		return int(n)
+	case int:
+		return n
+	case int64:
+		return int(n)
+	}
+	return 0
+}
+
+// Coverage is the share of a book's text its owner already knows
+type Coverage struct {
+	KnownWords        int     `json:"known_words"`         // Word tokens
+	KnownUniqueWords  int     `json:"known_unique_words"`  // Distinct words
+	TokenPercent      float64 `json:"token_percent"`       // 0-100
+	UniqueWordPercent float64 `json:"unique_word_percent"` // 0-100
+}
+
+// Coverage returns the owner's coverage of the book, or nil if it has not
+// been analyzed
+func (b *Book) Coverage() *Coverage {
+	if b.WordCount == 0 || b.UniqueWordCount == 0 {
+		return nil
+	}
+	return &Coverage{
+		KnownWords:        b.KnownWordCount,
+		KnownUniqueWords:  b.KnownUniqueWordCount,
+		TokenPercent:      percent(b.KnownWordCount, b.WordCount),
+		UniqueWordPercent: percent(b.KnownUniqueWordCount, b.UniqueWordCount),
+	}
+}
+
+func percent(part, whole int) float64 {
+	return math.Round(float64(part)/float64(whole)*1000) / 10
+}
+
 // ToResponse converts the book to a response format
 func (b *Book) ToResponse() BookResponse {
 	return BookResponse{
@@ -70,6 +219,8 @@ func (b *Book) ToResponse() BookResponse {
 		WordCount:        b.WordCount,
 		UniqueWordCount:  b.UniqueWordCount,
 		DifficultyLevel:  b.DifficultyLevel,
+		Difficulty:       b.DifficultyProfile,
+		Coverage:         b.Coverage(),
 		UploadedAt:       b.UploadedAt,
 		LastReadAt:       b.LastReadAt,
 		ReadingProgress:  b.ReadingProgress,
@@ -91,12 +242,55 @@ type BookResponse struct {
 	WordCount        int                      `json:"word_count"`
 	UniqueWordCount  int                      `json:"unique_word_count"`
 	DifficultyLevel  string                   `json:"difficulty_level"`
+	Difficulty       *DifficultyProfile       `json:"difficulty"`
+	Coverage         *Coverage                `json:"coverage"`
 	UploadedAt       time.Time                `json:"uploaded_at"`
 	LastReadAt       *time.Time               `json:"last_read_at"`
 	ReadingProgress  float64                  `json:"reading_progress"`
 	ChapterData      []map[string]interface{} `json:"chapter_data"`
 }
 
+// BookWord records how often a word occurs in a book
+type BookWord struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// Foreign keys
+	BookID uint `json:"book_id" gorm:"not null;uniqueIndex:idx_book_words_book_word"`
+	WordID uint `json:"word_id" gorm:"not null;uniqueIndex:idx_book_words_book_word;index"`
+	Word   Word `json:"word,omitempty" gorm:"foreignKey:WordID"`
+
+	// Occurrence data
+	Occurrences   int `json:"occurrences" gorm:"not null;default:0"`
+	FirstPosition int `json:"first_position" gorm:"not null;default:0"` // Character position of the first occurrence
+}
+
+// TableName specifies the table name for GORM
+func (BookWord) TableName() string {
+	return "book_words"
+}
+
+// BookSentence stores the boundaries of one sentence of a book's text
+type BookSentence struct {
+	ID     uint `json:"id" gorm:"primarykey"`
+	BookID uint `json:"book_id" gorm:"not null;uniqueIndex:idx_book_sentences_book_index;index:idx_book_sentences_position,priority:1"`
+
+	// Sentence number within the book, starting at 0
+	Index int `json:"index" gorm:"column:sentence_index;not null;uniqueIndex:idx_book_sentences_book_index"`
+
+	// Character positions in ExtractedText, end exclusive
+	StartPosition int `json:"start_position" gorm:"not null;index:idx_book_sentences_position,priority:2"`
+	EndPosition   int `json:"end_position" gorm:"not null"`
+
+	// Words of the sentence in order of appearance, repeats included
+	WordIDs []uint `json:"word_ids" gorm:"serializer:json"`
+}
+
+// TableName specifies the table name for GORM
+func (BookSentence) TableName() string {
+	return "book_sentences"
+}
+
 // ReadingSession represents a reading session
 type ReadingSession struct {
 	ID        uint           `json:"id" gorm:"primarykey"`
@@ -150,7 +344,7 @@ type BookAnnotation struct {
 	SelectedText  string `json:"selected_text" gorm:"type:text;not null"`
 
 	// Annotation data
-	AnnotationType string                 `json:"annotation_type" gorm:"size:20;default:word_lookup"` // word_lookup, note, highlight
+	AnnotationType string                 `json:"annotation_type" gorm:"size:20;default:word_lookup"` // word_lookup, note, highlight, mined
 	AnnotationData map[string]interface{} `json:"annotation_data" gorm:"serializer:json"`             // Flexible data storage
 
 	// Visual styling
@@ -161,3 +355,11 @@ type BookAnnotation struct {
 func (BookAnnotation) TableName() string {
 	return "book_annotations"
 }
+
+// Annotation types for BookAnnotation.AnnotationType
+const (
+	AnnotationWordLookup = "word_lookup"
+	AnnotationNote       = "note"
+	AnnotationHighlight  = "highlight"
+	AnnotationMined      = "mined" // Sentence turned into an SRS card; data holds card_id and word_id
+)
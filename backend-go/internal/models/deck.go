@@ -0,0 +1,63 @@
+package models
+
+import (
+	"time"
+)
+
+// Deck groups a user's SRS cards and holds the options for them
+type Deck struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	UserID    uint   `json:"user_id" gorm:"not null;uniqueIndex:idx_decks_user_name"`
+	Name      string `json:"name" gorm:"size:100;not null;uniqueIndex:idx_decks_user_name"`
+	IsDefault bool   `json:"is_default" gorm:"not null"` // Where cards go when no deck is given
+
+	// Options
+	CardTypes    []string `json:"card_types" gorm:"serializer:json;not null"` // Types of card made for each word added
+	BurySiblings bool     `json:"bury_siblings" gorm:"not null"`              // Hide a word's other cards for the day once one is reviewed
+
+	// Filtered decks borrow the cards their filter selects from the other
+	// decks and hand them back when emptied
+	IsFiltered bool        `json:"is_filtered" gorm:"not null"`
+	Filter     *DeckFilter `json:"filter,omitempty" gorm:"serializer:json"`
+
+	CardCount int64 `json:"card_count" gorm:"-"`
+}
+
+// TableName specifies the table name for GORM
+func (Deck) TableName() string {
+	return "decks"
+}
+
+// DeckFilter selects a user's cards. All the given conditions must hold.
+type DeckFilter struct {
+	DeckID        *uint    `json:"deck_id,omitempty"`                                            // Cards of this deck
+	BookID        *uint    `json:"book_id,omitempty"`                                            // Cards of words in this book
+	JLPTLevel     *int     `json:"jlpt_level,omitempty" binding:"omitempty,min=1,max=5"`         // Cards of words at this JLPT level
+	DueWithinDays *int     `json:"due_within_days,omitempty" binding:"omitempty,min=0,max=3650"` // Cards studied before that are due by the end of the day in this many days
+	States        []string `json:"states,omitempty" binding:"omitempty,dive,oneof=new learning review relearning"`
+	Leech         bool     `json:"leech,omitempty"`                                    // Only leeches
+	Limit         int      `json:"limit,omitempty" binding:"omitempty,min=1,max=9999"` // Most cards a filtered deck takes, 100 by default
+}
+
+// CreateDeckRequest creates a deck. CardTypes defaults to recognition only.
+// A deck with a Filter is a filtered deck; MoveCards instead moves the
+// matching cards into a new normal deck, e.g. to make a deck per book.
+type CreateDeckRequest struct {
+	Name         string      `json:"name" binding:"required,max=100"`
+	CardTypes    []string    `json:"card_types" binding:"omitempty,min=1,dive,oneof=recognition recall production"`
+	BurySiblings *bool       `json:"bury_siblings"`
+	Filter       *DeckFilter `json:"filter"`
+	MoveCards    *DeckFilter `json:"move_cards"`
+}
+
+// UpdateDeckRequest changes a deck's name or options. Changing the filter
+// of a filtered deck rebuilds it.
+type UpdateDeckRequest struct {
+	Name         *string     `json:"name" binding:"omitempty,min=1,max=100"`
+	CardTypes    []string    `json:"card_types" binding:"omitempty,min=1,dive,oneof=recognition recall production"`
+	BurySiblings *bool       `json:"bury_siblings"`
+	Filter       *DeckFilter `json:"filter"`
+}
@@ -0,0 +1,213 @@
+package models
+
+import (
+	"time"
+)
+
+// Card types for SRSCard.CardType
+const (
+	CardTypeRecognition = "recognition" // Word -> meaning
+	CardTypeRecall      = "recall"      // Meaning -> word
+	CardTypeProduction  = "production"  // Write the word
+	CardTypeSentence    = "sentence"    // Mined sentence -> target word
+)
+
+// SRSCard is a flashcard scheduled by the spaced repetition system
+type SRSCard struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// Foreign keys
+	UserID uint  `json:"user_id" gorm:"not null;uniqueIndex:idx_srs_cards_user_word_type;index:idx_srs_cards_user"`
+	WordID uint  `json:"word_id" gorm:"not null;uniqueIndex:idx_srs_cards_user_word_type"`
+	Word   Word  `json:"word,omitempty" gorm:"foreignKey:WordID"`
+	DeckID *uint `json:"deck_id" gorm:"index"`
+
+	OriginalDeckID *uint `json:"original_deck_id" gorm:"index"` // Home deck while a filtered deck borrows the card
+
+	// Card type and content
+	CardType     string                 `json:"card_type" gorm:"size:20;default:recognition;uniqueIndex:idx_srs_cards_user_word_type"` // recognition, recall, production, sentence
+	FrontContent map[string]interface{} `json:"front_content" gorm:"serializer:json;not null"`                                         // {text, furigana, audio_url}
+	BackContent  map[string]interface{} `json:"back_content" gorm:"serializer:json;not null"`                                          // {definition, example, notes}
+
+	// SRS algorithm data
+	State           string  `json:"state" gorm:"size:20;default:new;index"`            // new, learning, review, relearning
+	LearningStep    int     `json:"learning_step" gorm:"default:0"`                    // Index into the (re)learning steps
+	EaseFactor      float64 `json:"ease_factor" gorm:"type:decimal(4,2);default:2.50"` // Anki-style ease factor
+	IntervalDays    int     `json:"interval_days" gorm:"default:1"`
+	RepetitionCount int     `json:"repetition_count" gorm:"default:0"` // Successful reviews since the last lapse
+	Lapses          int     `json:"lapses" gorm:"default:0"`
+	Stability       float64 `json:"stability"`  // FSRS: days until recall drops to 90%
+	Difficulty      float64 `json:"difficulty"` // FSRS: 1 (easy) to 10 (hard)
+
+	// Scheduling
+	DueDate        time.Time  `json:"due_date" gorm:"index:idx_srs_cards_due,priority:1"`
+	LastReviewedAt *time.Time `json:"last_reviewed_at"`
+	UndoneAt       *time.Time `json:"undone_at"` // Set when a review is undone; the card is studied first until reviewed again
+
+	// Performance tracking
+	TotalReviews   int `json:"total_reviews" gorm:"default:0"`
+	CorrectReviews int `json:"correct_reviews" gorm:"default:0"`
+	CurrentStreak  int `json:"current_streak" gorm:"default:0"`
+	LongestStreak  int `json:"longest_streak" gorm:"default:0"`
+
+	// Card state
+	IsSuspended bool       `json:"is_suspended" gorm:"default:false;index:idx_srs_cards_due,priority:2"`
+	IsBuried    bool       `json:"is_buried" gorm:"default:false"` // Temporarily hidden
+	BuriedUntil *time.Time `json:"buried_until"`
+	IsLeech     bool       `json:"is_leech" gorm:"default:false"` // Forgotten over and over
+}
+
+// TableName specifies the table name for GORM
+func (SRSCard) TableName() string {
+	return "srs_cards"
+}
+
+// Card states for SRSCard.State
+const (
+	CardStateNew        = "new"
+	CardStateLearning   = "learning"
+	CardStateReview     = "review"
+	CardStateRelearning = "relearning"
+)
+
+// ReviewHistory records one review of a card with the card's scheduling
+// state before and after it
+type ReviewHistory struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// Foreign keys
+	UserID uint `json:"user_id" gorm:"not null;index:idx_review_history_user"`
+	CardID uint `json:"card_id" gorm:"not null;index"`
+
+	ReviewedAt      time.Time `json:"reviewed_at" gorm:"not null;index:idx_review_history_date"`
+	ResponseQuality int       `json:"response_quality" gorm:"not null"` // 1=again, 2=hard, 3=good, 4=easy
+	ResponseTimeMs  *int      `json:"response_time_ms"`
+
+	// Pre-review state
+	OldState      string    `json:"old_state" gorm:"size:20"`
+	OldStep       int       `json:"old_step"`
+	OldInterval   int       `json:"old_interval"`
+	OldEaseFactor float64   `json:"old_ease_factor" gorm:"type:decimal(4,2)"`
+	OldStability  float64   `json:"old_stability"`
+	OldDifficulty float64   `json:"old_difficulty"`
+	OldDueDate    time.Time `json:"old_due_date"`
+
+	// Rest of the pre-review card, so the review can be undone
+	OldLapses         int        `json:"-"`
+	OldRepetitions    int        `json:"-"`
+	OldStreak         int        `json:"-"`
+	OldLongestStreak  int        `json:"-"`
+	OldIsLeech        bool       `json:"-"`
+	OldIsSuspended    bool       `json:"-"`
+	OldLastReviewedAt *time.Time `json:"-"`
+	OldDeckID         *uint      `json:"-"`
+	NewIsSuspended    bool       `json:"-"`
+	HasUndoSnapshot   bool       `json:"-" gorm:"not null;default:false"` // Unset on rows recorded before undo or imported
+
+	// Post-review state
+	NewState      string    `json:"new_state" gorm:"size:20"`
+	NewStep       int       `json:"new_step"`
+	NewInterval   int       `json:"new_interval"`
+	NewEaseFactor float64   `json:"new_ease_factor" gorm:"type:decimal(4,2)"`
+	NewStability  float64   `json:"new_stability"`
+	NewDifficulty float64   `json:"new_difficulty"`
+	NewDueDate    time.Time `json:"new_due_date"`
+
+	// Context
+	ReviewContext string `json:"review_context" gorm:"size:50"` // reader, srs_session, manual
+	DeviceType    string `json:"device_type" gorm:"size:20"`    // desktop, mobile, tablet
+}
+
+// TableName specifies the table name for GORM
+func (ReviewHistory) TableName() string {
+	return "review_history"
+}
+
+// FSRSOptimization is one run of the optimizer that fits a user's FSRS
+// weights to their review history
+type FSRSOptimization struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	UserID  uint   `json:"user_id" gorm:"not null;index;uniqueIndex:idx_fsrs_optimizations_active,where:status = 'pending' OR status = 'running'"`
+	Status  string `json:"status" gorm:"size:20;not null"`  // pending, running, completed, skipped, failed
+	Trigger string `json:"trigger" gorm:"size:20;not null"` // manual, weekly
+	Error   string `json:"error,omitempty" gorm:"type:text"`
+
+	// Fit of the weights before and after, scored on the reviews of held-out
+	// cards that the fit never saw
+	Reviews        int       `json:"reviews"`
+	HeldOutReviews int       `json:"held_out_reviews"`
+	LogLossBefore  float64   `json:"log_loss_before"`
+	LogLossAfter   float64   `json:"log_loss_after"`
+	RMSEBefore     float64   `json:"rmse_before"`
+	RMSEAfter      float64   `json:"rmse_after"`
+	WeightsBefore  []float64 `json:"weights_before" gorm:"serializer:json"`
+	WeightsAfter   []float64 `json:"weights_after" gorm:"serializer:json"`
+	Applied        bool      `json:"applied"` // Whether the new weights replaced the old ones
+
+	StartedAt  *time.Time `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+}
+
+// TableName specifies the table name for GORM
+func (FSRSOptimization) TableName() string {
+	return "fsrs_optimizations"
+}
+
+// CreateCardRequest adds a word to one of the user's decks, the default one
+// unless DeckID is given, with a card of each type the deck has turned on or
+// only of CardType. BookID and Position optionally name the place in a book
+// the example sentence comes from.
+type CreateCardRequest struct {
+	WordID   uint   `json:"word_id" binding:"required"`
+	DeckID   *uint  `json:"deck_id,omitempty"`
+	CardType string `json:"card_type,omitempty" binding:"omitempty,oneof=recognition recall production"`
+	BookID   *uint  `json:"book_id"`
+	Position *int   `json:"position" binding:"omitempty,min=0"`
+}
+
+// MineSentenceRequest turns a sentence of a book into a card for one word of
+// it. Positions are character offsets into the book's text; the target's
+// position is found automatically when left out.
+type MineSentenceRequest struct {
+	BookID        uint `json:"book_id" binding:"required"`
+	StartPosition *int `json:"start_position" binding:"required,min=0"`
+	EndPosition   int  `json:"end_position" binding:"required,min=1"`
+	WordID        uint `json:"word_id" binding:"required"`
+	TargetStart   *int `json:"target_start" binding:"omitempty,min=0"`
+	TargetEnd     *int `json:"target_end" binding:"omitempty,min=1"`
+}
+
+// Actions of CardActionRequest
+const (
+	CardActionSuspend    = "suspend"
+	CardActionUnsuspend  = "unsuspend"
+	CardActionBury       = "bury"
+	CardActionUnbury     = "unbury"
+	CardActionForget     = "forget"     // Back to new, keeping the review counts
+	CardActionReset      = "reset"      // Back to new, clearing the review counts and leech tag
+	CardActionReschedule = "reschedule" // Due in Days days
+	CardActionMove       = "move"       // To the normal deck DeckID
+)
+
+// CardActionRequest applies an action to one card, or in bulk to CardIDs
+type CardActionRequest struct {
+	CardIDs []uint `json:"card_ids" binding:"omitempty,max=5000"`
+	Action  string `json:"action" binding:"omitempty,oneof=suspend unsuspend bury unbury forget reset reschedule move"`
+	Days    *int   `json:"days" binding:"omitempty,min=0,max=36500"`
+	DeckID  *uint  `json:"deck_id"`
+}
+
+// ReviewRequest grades a review of a card
+type ReviewRequest struct {
+	CardID         uint   `json:"card_id" binding:"required"`
+	Grade          int    `json:"grade" binding:"required,min=1,max=4"` // 1=again, 2=hard, 3=good, 4=easy
+	ResponseTimeMs *int   `json:"response_time_ms" binding:"omitempty,min=0"`
+	ReviewContext  string `json:"review_context" binding:"omitempty,oneof=reader srs_session manual"`
+	DeviceType     string `json:"device_type" binding:"omitempty,oneof=desktop mobile tablet"`
+}
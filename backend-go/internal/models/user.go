@@ -19,9 +19,13 @@ type User struct {
 	Email    string `json:"email" gorm:"uniqueIndex;size:100;not null"`
 	Password string `json:"-" gorm:"size:255;not null"`
 
+	// SHA-256 of the key AnkiConnect clients such as Yomitan send
+	APIKeyHash *string `json:"-" gorm:"size:64;uniqueIndex"`
+
 	// User status
 	IsActive          bool   `json:"is_active" gorm:"default:true"`
 	PreferredLanguage string `json:"preferred_language" gorm:"size:10;default:en"`
+	Timezone          string `json:"timezone" gorm:"size:64;default:UTC"` // IANA name, e.g. Asia/Tokyo
 
 	// Learning statistics
 	TotalWordsLearned int       `json:"total_words_learned" gorm:"default:0"`
@@ -42,6 +46,63 @@ func (User) TableName() string {
 	return "users"
 }
 
+// Keys used in LearningPreferences
+const (
+	PrefFuriganaThreshold = "furigana_threshold"  // Knowledge level from which readings are hidden
+	PrefKnownKanji        = "known_kanji"         // Kanji the user has learned, as a single string
+	PrefScheduler         = "srs_scheduler"       // SRS scheduler, sm2 or fsrs
+	PrefFSRSWeights       = "fsrs_weights"        // The user's own FSRS weights
+	PrefDesiredRetention  = "desired_retention"   // FSRS target chance of recall, 0.7 to 0.99
+	PrefNewCardsPerDay    = "new_cards_per_day"   // New SRS cards introduced per day
+	PrefMaxReviewsPerDay  = "max_reviews_per_day" // Review cards shown per day
+	PrefLearnAheadMinutes = "learn_ahead_minutes" // How early learning cards may be shown
+	PrefDayRolloverHour   = "day_rollover_hour"   // Local hour at which a new SRS day starts
+	PrefLeechThreshold    = "leech_threshold"     // Lapses after which a card is a leech
+	PrefLeechAction       = "leech_action"        // What happens to leeches, tag or suspend
+)
+
+// Location returns the user's time zone, UTC if unset or unknown
+func (u *User) Location() *time.Location {
+	if u.Timezone == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(u.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// PreferenceInt returns an integer learning preference or defaultValue if unset
+func (u *User) PreferenceInt(key string, defaultValue int) int {
+	switch v := u.LearningPreferences[key].(type) {
+	case float64:
+		return int(v)
+	case int:
+		return v
+	}
+	return defaultValue
+}
+
+// PreferenceFloat returns a numeric learning preference or defaultValue if unset
+func (u *User) PreferenceFloat(key string, defaultValue float64) float64 {
+	switch v := u.LearningPreferences[key].(type) {
+	case float64:
+		return v
+	case int:
+		return float64(v)
+	}
+	return defaultValue
+}
+
+// PreferenceString returns a string learning preference or defaultValue if unset
+func (u *User) PreferenceString(key, defaultValue string) string {
+	if v, ok := u.LearningPreferences[key].(string); ok {
+		return v
+	}
+	return defaultValue
+}
+
 // HashPassword hashes the user's password
 func (u *User) HashPassword() error {
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(u.Password), bcrypt.DefaultCost)
@@ -66,11 +127,13 @@ func (u *User) ToResponse() UserResponse {
 		CreatedAt:           u.CreatedAt,
 		IsActive:            u.IsActive,
 		PreferredLanguage:   u.PreferredLanguage,
+		Timezone:            u.Timezone,
 		TotalWordsLearned:   u.TotalWordsLearned,
 		TotalReadingTime:    u.TotalReadingTime,
 		StreakDays:          u.StreakDays,
 		LastActivity:        u.LastActivity,
 		LearningPreferences: u.LearningPreferences,
+		HasAPIKey:           u.APIKeyHash != nil,
 	}
 }
 
@@ -82,11 +145,13 @@ type UserResponse struct {
 	CreatedAt           time.Time              `json:"created_at"`
 	IsActive            bool                   `json:"is_active"`
 	PreferredLanguage   string                 `json:"preferred_language"`
+	Timezone            string                 `json:"timezone"`
 	TotalWordsLearned   int                    `json:"total_words_learned"`
 	TotalReadingTime    int                    `json:"total_reading_time"`
 	StreakDays          int                    `json:"streak_days"`
 	LastActivity        *time.Time             `json:"last_activity"`
 	LearningPreferences map[string]interface{} `json:"learning_preferences"`
+	HasAPIKey           bool                   `json:"has_api_key"`
 }
 
 // CreateUserRequest is the request format for creating a user
@@ -95,6 +160,13 @@ type CreateUserRequest struct {
 	Email             string `json:"email" binding:"required,email"`
 	Password          string `json:"password" binding:"required,min=6"`
 	PreferredLanguage string `json:"preferred_language"`
+	Timezone          string `json:"timezone" binding:"omitempty,max=64"`
+}
+
+// UpdateUserRequest changes the current user's settings
+type UpdateUserRequest struct {
+	PreferredLanguage *string `json:"preferred_language" binding:"omitempty,min=2,max=10"`
+	Timezone          *string `json:"timezone" binding:"omitempty,min=1,max=64"`
 }
 
 // LoginRequest is the request format for user login
@@ -0,0 +1,153 @@
+package models
+
+import (
+	"time"
+)
+
+// Knowledge levels for UserWordKnowledge.KnowledgeLevel
+const (
+	KnowledgeUnknown    = 0
+	KnowledgeRecognized = 1
+	KnowledgeFamiliar   = 2
+	KnowledgeKnown      = 3
+	KnowledgeMastered   = 4
+)
+
+// Word represents a dictionary entry
+type Word struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// Forms
+	SurfaceForm   string `json:"surface_form" gorm:"size:100;not null;uniqueIndex:idx_words_surface_reading;index:idx_words_surface"` // e.g. 食べる
+	Reading       string `json:"reading" gorm:"size:100;uniqueIndex:idx_words_surface_reading;index:idx_words_reading"`               // Hiragana, e.g. たべる
+	Pronunciation string `json:"pronunciation" gorm:"size:100"`
+
+	// Linguistic information
+	PartOfSpeech   string `json:"part_of_speech" gorm:"size:50"`
+	InflectionType string `json:"inflection_type" gorm:"size:50"`
+	BaseForm       string `json:"base_form" gorm:"size:100"`
+
+	// Difficulty indicators
+	JLPTLevel     *int `json:"jlpt_level" gorm:"index:idx_words_jlpt"` // 1-5, null if not in JLPT
+	WanikaniLevel *int `json:"wanikani_level"`                         // 1-60
+	KankenLevel   *int `json:"kanken_level"`                           // 1-10
+	FrequencyRank *int `json:"frequency_rank"`
+
+	// Relationships
+	Definitions []WordDefinition `json:"definitions,omitempty" gorm:"foreignKey:WordID"`
+}
+
+// TableName specifies the table name for GORM
+func (Word) TableName() string {
+	return "words"
+}
+
+// WordDefinition is one definition of a word from a given dictionary
+type WordDefinition struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// Foreign key
+	WordID uint `json:"word_id" gorm:"not null;index:idx_definitions_word"`
+
+	// Definition data
+	DictionarySource   string `json:"dictionary_source" gorm:"size:50;not null;index:idx_definitions_source"` // sanseido, daijirin, ookoku, jitendex, jisho
+	Language           string `json:"language" gorm:"size:10;not null"`                                       // en, ja
+	Definition         string `json:"definition" gorm:"type:text;not null"`
+	ExampleSentence    string `json:"example_sentence" gorm:"type:text"`
+	ExampleTranslation string `json:"example_translation" gorm:"type:text"`
+
+	// Additional metadata
+	DefinitionOrder int      `json:"definition_order" gorm:"default:1"`
+	Tags            []string `json:"tags" gorm:"serializer:json"`
+}
+
+// TableName specifies the table name for GORM
+func (WordDefinition) TableName() string {
+	return "word_definitions"
+}
+
+// DictionaryCacheEntry stores a response from an external dictionary API so
+// repeated lookups do not hit the network
+type DictionaryCacheEntry struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	Source    string    `json:"source" gorm:"size:50;not null;uniqueIndex:idx_dictionary_cache_key"` // e.g. jisho
+	Query     string    `json:"query" gorm:"size:255;not null;uniqueIndex:idx_dictionary_cache_key"`
+	Response  []byte    `json:"-" gorm:"not null"`
+	ExpiresAt time.Time `json:"expires_at" gorm:"index"`
+}
+
+// TableName specifies the table name for GORM
+func (DictionaryCacheEntry) TableName() string {
+	return "dictionary_cache"
+}
+
+// UserWordKnowledge tracks how well a user knows a word
+type UserWordKnowledge struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// Foreign keys
+	UserID uint `json:"user_id" gorm:"not null;uniqueIndex:idx_user_words_user_word;index:idx_user_words_user"`
+	WordID uint `json:"word_id" gorm:"not null;uniqueIndex:idx_user_words_user_word"`
+	Word   Word `json:"word,omitempty" gorm:"foreignKey:WordID"`
+
+	// Knowledge status
+	KnowledgeLevel     int        `json:"knowledge_level" gorm:"default:0;index:idx_user_words_level"` // 0=unknown, 1=recognized, 2=familiar, 3=known, 4=mastered
+	FirstEncounteredAt time.Time  `json:"first_encountered_at" gorm:"autoCreateTime"`
+	LastReviewedAt     *time.Time `json:"last_reviewed_at"`
+
+	// SRS data
+	SRSLevel     int        `json:"srs_level" gorm:"default:0"`
+	NextReviewAt *time.Time `json:"next_review_at" gorm:"index:idx_user_words_next_review"`
+	ReviewCount  int        `json:"review_count" gorm:"default:0"`
+	CorrectCount int        `json:"correct_count" gorm:"default:0"`
+	Streak       int        `json:"streak" gorm:"default:0"`
+
+	// Context tracking
+	FirstSeenBookID  *uint `json:"first_seen_book_id"`
+	TimesEncountered int   `json:"times_encountered" gorm:"default:0"` // Lookups and marks while reading
+
+	// Learning metadata
+	Notes     string `json:"notes" gorm:"type:text"`
+	IsIgnored bool   `json:"is_ignored" gorm:"default:false"` // User marked as "ignore this word"
+}
+
+// TableName specifies the table name for GORM
+func (UserWordKnowledge) TableName() string {
+	return "user_word_knowledge"
+}
+
+// WordRef names a word either by ID or by its dictionary form and reading
+type WordRef struct {
+	WordID  uint   `json:"word_id"`
+	Word    string `json:"word"`
+	Reading string `json:"reading"` // Optional when the form alone is unambiguous
+}
+
+// MarkWordRequest sets a user's knowledge of one word
+type MarkWordRequest struct {
+	WordRef
+	KnowledgeLevel *int    `json:"knowledge_level" binding:"omitempty,min=0,max=4"` // Defaults to known
+	BookID         *uint   `json:"book_id"`                                         // Book the word was met in
+	Notes          *string `json:"notes"`
+}
+
+// BulkKnowledgeRequest sets the same knowledge level on several words
+type BulkKnowledgeRequest struct {
+	Words          []WordRef `json:"words" binding:"required,min=1,max=5000"`
+	KnowledgeLevel *int      `json:"knowledge_level" binding:"required,min=0,max=4"`
+	BookID         *uint     `json:"book_id"`
+}
+
+// BulkIgnoreRequest marks several words as ignored, or un-ignores them
+type BulkIgnoreRequest struct {
+	Words   []WordRef `json:"words" binding:"required,min=1,max=5000"`
+	Ignored *bool     `json:"ignored"` // Defaults to true
+}
@@ -0,0 +1,249 @@
+package optimizer
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"japanese-learning-app/internal/models"
+	"japanese-learning-app/internal/srs"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Run states for FSRSOptimization.Status
+const (
+	StatusPending   = "pending"
+	StatusRunning   = "running"
+	StatusCompleted = "completed"
+	StatusSkipped   = "skipped" // Too few reviews to fit
+	StatusFailed    = "failed"
+)
+
+// What started a run, for FSRSOptimization.Trigger
+const (
+	TriggerManual = "manual"
+	TriggerWeekly = "weekly"
+)
+
+const (
+	// MinReviews is how many scorable reviews a fit needs
+	MinReviews = 400
+	// holdOutEvery sets aside every fifth card, by ID, to judge the fit on
+	holdOutEvery = 5
+	// Interval is how often each FSRS user's weights are refitted
+	Interval = 7 * 24 * time.Hour
+)
+
+// ErrRunning is returned when the user already has a run in progress
+var ErrRunning = errors.New("an optimization is already running")
+
+// Optimizer fits users' FSRS weights to their review history in the
+// background
+type Optimizer struct {
+	db      *gorm.DB
+	options srs.FitOptions
+}
+
+// New creates an optimizer
+func New(db *gorm.DB) *Optimizer {
+	return &Optimizer{db: db, options: srs.DefaultFitOptions}
+}
+
+// Start records a pending run for the user. Run it with Run. A user has
+// at most one pending or running run, which the table's unique index
+// enforces.
+func (o *Optimizer) Start(userID uint, trigger string) (*models.FSRSOptimization, error) {
+	run := models.FSRSOptimization{UserID: userID, Status: StatusPending, Trigger: trigger}
+	result := o.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&run)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrRunning
+	}
+	return &run, nil
+}
+
+// ResetInterrupted marks runs left pending or running when the server
+// stopped as failed, so that new ones can start
+func (o *Optimizer) ResetInterrupted() (int64, error) {
+	result := o.db.Model(&models.FSRSOptimization{}).
+		Where("status IN ?", []string{StatusPending, StatusRunning}).
+		Updates(map[string]interface{}{"status": StatusFailed, "error": "interrupted by a server restart"})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to reset interrupted optimizations: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+// Run fits new weights for a pending run's user and applies them if they
+// predict the reviews of held-out cards better than the current ones
+func (o *Optimizer) Run(runID uint) error {
+	var run models.FSRSOptimization
+	if err := o.db.First(&run, runID).Error; err != nil {
+		return fmt.Errorf("failed to load optimization %d: %w", runID, err)
+	}
+	started := time.Now()
+	run.Status = StatusRunning
+	run.StartedAt = &started
+	if err := o.db.Save(&run).Error; err != nil {
+		return fmt.Errorf("failed to start optimization %d: %w", runID, err)
+	}
+
+	if err := o.run(&run); err != nil {
+		run.Status = StatusFailed
+		run.Error = err.Error()
+	}
+	finished := time.Now()
+	run.FinishedAt = &finished
+	if err := o.db.Save(&run).Error; err != nil {
+		return fmt.Errorf("failed to finish optimization %d: %w", runID, err)
+	}
+	if run.Status == StatusFailed {
+		return fmt.Errorf("optimization %d failed: %s", runID, run.Error)
+	}
+	return nil
+}
+
+func (o *Optimizer) run(run *models.FSRSOptimization) error {
+	var user models.User
+	if err := o.db.First(&user, run.UserID).Error; err != nil {
+		return fmt.Errorf("failed to load user %d: %w", run.UserID, err)
+	}
+	training, heldOut, err := o.histories(user.ID)
+	if err != nil {
+		return err
+	}
+
+	current := srs.UserFSRSParams(&user).Weights
+	trained := srs.EvaluateWeights(current, training)
+	before := srs.EvaluateWeights(current, heldOut)
+	run.WeightsBefore = current
+	run.Reviews = trained.Reviews + before.Reviews
+	run.HeldOutReviews = before.Reviews
+	run.LogLossBefore = before.LogLoss
+	run.RMSEBefore = before.RMSE
+	if run.Reviews < MinReviews || before.Reviews == 0 {
+		run.Status = StatusSkipped
+		run.Error = fmt.Sprintf("needs at least %d reviews a day or more apart, some on held-out cards; found %d, %d held out",
+			MinReviews, run.Reviews, before.Reviews)
+		return nil
+	}
+
+	// Judging the fit on the reviews it was fitted to would favour
+	// overfitted weights
+	fitted := srs.FitWeights(current, training, o.options)
+	after := srs.EvaluateWeights(fitted, heldOut)
+	run.WeightsAfter = fitted
+	run.LogLossAfter = after.LogLoss
+	run.RMSEAfter = after.RMSE
+	run.Status = StatusCompleted
+	if after.LogLoss >= before.LogLoss {
+		return nil
+	}
+
+	// Reload the preferences so changes made during the fit are kept, and
+	// hold the row so none are made until the weights are saved
+	err = o.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, user.ID).Error; err != nil {
+			return err
+		}
+		prefs := make(map[string]interface{}, len(user.LearningPreferences)+1)
+		for k, v := range user.LearningPreferences {
+			prefs[k] = v
+		}
+		prefs[models.PrefFSRSWeights] = fitted
+		return tx.Model(&models.User{ID: user.ID}).Select("learning_preferences").
+			Updates(&models.User{LearningPreferences: prefs}).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save weights: %w", err)
+	}
+	run.Applied = true
+	return nil
+}
+
+// histories loads the grades of the user's reviews, per card in order, split
+// into the cards to fit on and the held-out cards to judge the fit on
+func (o *Optimizer) histories(userID uint) (training, heldOut [][]srs.FSRSReview, err error) {
+	var rows []models.ReviewHistory
+	err = o.db.Select("card_id", "reviewed_at", "response_quality").
+		Where("user_id = ?", userID).
+		Order("card_id").Order("reviewed_at").Order("id").
+		Find(&rows).Error
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load review history: %w", err)
+	}
+
+	var history []srs.FSRSReview
+	var card uint
+	flush := func() {
+		if len(history) == 0 {
+			return
+		}
+		if card%holdOutEvery == 0 {
+			heldOut = append(heldOut, history)
+		} else {
+			training = append(training, history)
+		}
+		history = nil
+	}
+	for _, row := range rows {
+		if !srs.Grade(row.ResponseQuality).Valid() {
+			continue
+		}
+		if row.CardID != card {
+			flush()
+			card = row.CardID
+		}
+		history = append(history, srs.FSRSReview{Grade: srs.Grade(row.ResponseQuality), ReviewedAt: row.ReviewedAt})
+	}
+	flush()
+	return training, heldOut, nil
+}
+
+// RunWeekly refits the weights of every FSRS user who reviewed in the last
+// week and has had no run for a week. It checks hourly and never returns.
+func (o *Optimizer) RunWeekly() {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		if err := o.runDue(); err != nil {
+			log.Printf("Weekly FSRS optimization failed: %v", err)
+		}
+		<-ticker.C
+	}
+}
+
+func (o *Optimizer) runDue() error {
+	since := time.Now().Add(-Interval)
+	var userIDs []uint
+	err := o.db.Model(&models.ReviewHistory{}).
+		Where("reviewed_at > ?", since).
+		Where("user_id NOT IN (?)", o.db.Model(&models.FSRSOptimization{}).Select("user_id").Where("created_at > ?", since)).
+		Distinct().Pluck("user_id", &userIDs).Error
+	if err != nil {
+		return fmt.Errorf("failed to find users to optimize: %w", err)
+	}
+
+	for _, id := range userIDs {
+		var user models.User
+		if err := o.db.First(&user, id).Error; err != nil {
+			continue
+		}
+		if srs.ForUser(&user).Name() != srs.SchedulerFSRS {
+			continue
+		}
+		run, err := o.Start(id, TriggerWeekly)
+		if err != nil {
+			continue
+		}
+		if err := o.Run(run.ID); err != nil {
+			log.Printf("FSRS optimization failed: %v", err)
+		}
+	}
+	return nil
+}
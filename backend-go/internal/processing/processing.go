@@ -0,0 +1,274 @@
+package processing
+
+import (
+	"fmt"
+	"time"
+	"unicode/utf8"
+
+	"japanese-learning-app/internal/analysis"
+	"japanese-learning-app/internal/knowledge"
+	"japanese-learning-app/internal/models"
+	"japanese-learning-app/internal/textproc"
+	"japanese-learning-app/internal/tokenizer"
+	"japanese-learning-app/internal/wordlist"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Book processing states for Book.ProcessingStatus
+const (
+	StatusPending    = "pending"
+	StatusProcessing = "processing"
+	StatusCompleted  = "completed"
+	StatusFailed     = "failed"
+)
+
+// StaleAfter is how long a book may stay processing before its analysis is
+// taken to have died and the book may be analyzed again
+const StaleAfter = time.Hour
+
+// maxWordLength matches the size of words.surface_form and words.reading
+const maxWordLength = 100
+
+// batchSize bounds IN lists and batched inserts
+const batchSize = 1000
+
+// Processor analyzes a book's extracted text: it tokenizes it, records the
+// book's vocabulary and sentence boundaries, and estimates its difficulty
+type Processor struct {
+	db        *gorm.DB
+	tokenizer *tokenizer.Tokenizer
+	lists     *wordlist.Lists
+}
+
+// New creates a processor
+func New(db *gorm.DB, tok *tokenizer.Tokenizer, lists *wordlist.Lists) *Processor {
+	return &Processor{db: db, tokenizer: tok, lists: lists}
+}
+
+// ProcessBook analyzes a book and stores the results. The book is marked
+// failed if anything goes wrong.
+func (p *Processor) ProcessBook(bookID uint) error {
+	var book models.Book
+	if err := p.db.First(&book, bookID).Error; err != nil {
+		return fmt.Errorf("failed to load book %d: %w", bookID, err)
+	}
+
+	if err := p.setStatus(book.ID, StatusProcessing); err != nil {
+		return err
+	}
+	if err := p.process(&book); err != nil {
+		p.setStatus(book.ID, StatusFailed)
+		return fmt.Errorf("failed to process book %d: %w", bookID, err)
+	}
+	return nil
+}
+
+// Start marks a book as processing unless its analysis is already running,
+// and reports whether it did. The check and the update are one statement, so
+// of two concurrent calls only one succeeds.
+func (p *Processor) Start(bookID uint, now time.Time) (bool, error) {
+	result := p.db.Model(&models.Book{}).
+		Where("id = ? AND (processing_status <> ? OR updated_at < ?)", bookID, StatusProcessing, now.Add(-StaleAfter)).
+		Update("processing_status", StatusProcessing)
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to start processing book %d: %w", bookID, result.Error)
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// ResetInterrupted marks books left processing when the server stopped as
+// failed, so that they can be analyzed again
+func (p *Processor) ResetInterrupted() (int64, error) {
+	result := p.db.Model(&models.Book{}).
+		Where("processing_status = ?", StatusProcessing).
+		Update("processing_status", StatusFailed)
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to reset interrupted books: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+func (p *Processor) setStatus(bookID uint, status string) error {
+	if err := p.db.Model(&models.Book{}).Where("id = ?", bookID).Update("processing_status", status).Error; err != nil {
+		return fmt.Errorf("failed to update status of book %d: %w", bookID, err)
+	}
+	return nil
+}
+
+func (p *Processor) process(book *models.Book) error {
+	text := []rune(book.ExtractedText)
+	tokens := p.tokenizer.Tokenize(book.ExtractedText)
+
+	words, err := p.resolveWords(tokens)
+	if err != nil {
+		return err
+	}
+
+	bookWords := make(map[uint]*models.BookWord)
+	var order []uint
+	for _, w := range words {
+		bw, ok := bookWords[w.WordID]
+		if !ok {
+			bw = &models.BookWord{BookID: book.ID, WordID: w.WordID, FirstPosition: w.Start}
+			bookWords[w.WordID] = bw
+			order = append(order, w.WordID)
+		}
+		bw.Occurrences++
+	}
+	rows := make([]models.BookWord, 0, len(order))
+	for _, id := range order {
+		rows = append(rows, *bookWords[id])
+	}
+
+	boundaries := textproc.SplitSentences(text)
+	sentences := make([]models.BookSentence, 0, len(boundaries))
+	for i, b := range boundaries {
+		sentences = append(sentences, models.BookSentence{
+			BookID:        book.ID,
+			Index:         i,
+			StartPosition: b.Start,
+			EndPosition:   b.End,
+		})
+	}
+	// Words are in text order, so one pass over both lists places them
+	next := 0
+	for _, w := range words {
+		for next < len(sentences) && sentences[next].EndPosition <= w.Start {
+			next++
+		}
+		if next == len(sentences) {
+			break
+		}
+		if sentences[next].StartPosition <= w.Start {
+			sentences[next].WordIDs = append(sentences[next].WordIDs, w.WordID)
+		}
+	}
+
+	book.WordCount = len(words)
+	book.UniqueWordCount = len(rows)
+	book.DifficultyProfile = analysis.EstimateDifficulty(text, words, p.lists.HasJLPT())
+	book.DifficultyLevel = book.DifficultyProfile.Level
+	book.ProcessingStatus = StatusCompleted
+	book.ChapterData = withProfiles(book, analysis.ChapterProfiles(text, book.Chapters(), words, p.lists.HasJLPT()))
+
+	return p.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("book_id = ?", book.ID).Delete(&models.BookWord{}).Error; err != nil {
+			return err
+		}
+		if len(rows) > 0 {
+			if err := tx.CreateInBatches(rows, batchSize).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Where("book_id = ?", book.ID).Delete(&models.BookSentence{}).Error; err != nil {
+			return err
+		}
+		if len(sentences) > 0 {
+			if err := tx.CreateInBatches(sentences, batchSize).Error; err != nil {
+				return err
+			}
+		}
+		err := tx.Model(book).
+			Select("word_count", "unique_word_count", "difficulty_level", "difficulty_profile", "chapter_data", "processing_status").
+			Updates(book).Error
+		if err != nil {
+			return err
+		}
+		return knowledge.RecomputeCoverage(tx, book.ID, book.UserID)
+	})
+}
+
+// withProfiles returns the book's chapter data with a profile stored on each
+// entry. A book without chapter data gets a single entry for the whole text.
+func withProfiles(book *models.Book, profiles []models.ChapterProfile) []map[string]interface{} {
+	chapters := book.Chapters()
+	data := make([]map[string]interface{}, len(chapters))
+	for i, chapter := range chapters {
+		entry := make(map[string]interface{})
+		if i < len(book.ChapterData) {
+			for k, v := range book.ChapterData[i] {
+				entry[k] = v
+			}
+		} else {
+			entry["title"] = chapter.Title
+			entry["start_pos"] = chapter.StartPos
+			entry["end_pos"] = chapter.EndPos
+		}
+		entry["profile"] = profiles[i]
+		data[i] = entry
+	}
+	return data
+}
+
+// resolveWords links word tokens to Word entries, creating entries for words
+// seen for the first time. Tokens that are not words are dropped.
+func (p *Processor) resolveWords(tokens []tokenizer.Token) ([]analysis.WordToken, error) {
+	type key struct{ form, reading string }
+
+	wanted := make(map[key]*models.Word)
+	var forms []string
+	for _, tok := range tokens {
+		if !tok.IsWord() || utf8.RuneCountInString(tok.BaseForm) > maxWordLength {
+			continue
+		}
+		k := key{tok.BaseForm, tok.BaseReading}
+		if _, ok := wanted[k]; ok {
+			continue
+		}
+		wanted[k] = &models.Word{
+			SurfaceForm:   tok.BaseForm,
+			Reading:       tok.BaseReading,
+			BaseForm:      tok.BaseForm,
+			PartOfSpeech:  tok.PartOfSpeech,
+			JLPTLevel:     p.lists.JLPTLevel(tok.BaseForm, tok.BaseReading),
+			FrequencyRank: p.lists.FrequencyRank(tok.BaseForm, tok.BaseReading),
+		}
+		forms = append(forms, tok.BaseForm)
+	}
+
+	// Create missing entries; existing ones are left untouched
+	var missing []*models.Word
+	for _, w := range wanted {
+		missing = append(missing, w)
+	}
+	if len(missing) > 0 {
+		err := p.db.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "surface_form"}, {Name: "reading"}},
+			DoNothing: true,
+		}).CreateInBatches(missing, batchSize).Error
+		if err != nil {
+			return nil, fmt.Errorf("failed to create words: %w", err)
+		}
+	}
+
+	// Reload to pick up IDs and data of entries that already existed
+	for start := 0; start < len(forms); start += batchSize {
+		var existing []models.Word
+		chunk := forms[start:min(start+batchSize, len(forms))]
+		if err := p.db.Where("surface_form IN ?", chunk).Find(&existing).Error; err != nil {
+			return nil, fmt.Errorf("failed to load words: %w", err)
+		}
+		for i := range existing {
+			if _, ok := wanted[key{existing[i].SurfaceForm, existing[i].Reading}]; ok {
+				wanted[key{existing[i].SurfaceForm, existing[i].Reading}] = &existing[i]
+			}
+		}
+	}
+
+	words := make([]analysis.WordToken, 0, len(tokens))
+	for _, tok := range tokens {
+		w, ok := wanted[key{tok.BaseForm, tok.BaseReading}]
+		if !ok || w.ID == 0 || !tok.IsWord() {
+			continue
+		}
+		words = append(words, analysis.WordToken{
+			Token:         tok,
+			WordID:        w.ID,
+			JLPTLevel:     w.JLPTLevel,
+			FrequencyRank: w.FrequencyRank,
+		})
+	}
+	return words, nil
+}
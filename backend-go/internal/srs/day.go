@@ -0,0 +1,66 @@
+package srs
+
+import (
+	"time"
+
+	"japanese-learning-app/internal/models"
+)
+
+// Defaults of the daily study settings, as in Anki
+const (
+	DefaultNewCardsPerDay    = 20
+	DefaultMaxReviewsPerDay  = 200
+	DefaultLearnAheadMinutes = 20
+	DefaultDayRolloverHour   = 4
+)
+
+// StudySettings are a user's daily limits and where their study day begins
+type StudySettings struct {
+	NewCardsPerDay   int
+	MaxReviewsPerDay int
+	LearnAhead       time.Duration // Learning cards due this soon are shown when nothing else is due
+	Location         *time.Location
+	RolloverHour     int // Local hour at which a new day starts
+}
+
+// UserStudySettings reads the study settings from the user's time zone and
+// learning preferences
+func UserStudySettings(user *models.User) StudySettings {
+	s := StudySettings{
+		NewCardsPerDay:   user.PreferenceInt(models.PrefNewCardsPerDay, DefaultNewCardsPerDay),
+		MaxReviewsPerDay: user.PreferenceInt(models.PrefMaxReviewsPerDay, DefaultMaxReviewsPerDay),
+		LearnAhead:       time.Duration(user.PreferenceInt(models.PrefLearnAheadMinutes, DefaultLearnAheadMinutes)) * time.Minute,
+		Location:         user.Location(),
+		RolloverHour:     user.PreferenceInt(models.PrefDayRolloverHour, DefaultDayRolloverHour),
+	}
+	if s.RolloverHour < 0 || s.RolloverHour > 23 {
+		s.RolloverHour = DefaultDayRolloverHour
+	}
+	s.NewCardsPerDay = max(s.NewCardsPerDay, 0)
+	s.MaxReviewsPerDay = max(s.MaxReviewsPerDay, 0)
+	s.LearnAhead = max(s.LearnAhead, 0)
+	return s
+}
+
+// DayStart returns when the study day containing t began, in t's location
+func (s StudySettings) DayStart(t time.Time) time.Time {
+	return s.dayStart(t).In(t.Location())
+}
+
+// DayEnd returns when the study day containing t ends, in t's location
+func (s StudySettings) DayEnd(t time.Time) time.Time {
+	y, m, d := s.dayStart(t).Date()
+	return time.Date(y, m, d+1, s.RolloverHour, 0, 0, 0, s.Location).In(t.Location())
+}
+
+// dayStart returns when the study day containing t began, in the user's
+// time zone
+func (s StudySettings) dayStart(t time.Time) time.Time {
+	local := t.In(s.Location)
+	y, m, d := local.Date()
+	start := time.Date(y, m, d, s.RolloverHour, 0, 0, 0, s.Location)
+	if local.Before(start) {
+		start = time.Date(y, m, d-1, s.RolloverHour, 0, 0, 0, s.Location)
+	}
+	return start
+}
@@ -0,0 +1,128 @@
+package srs
+
+import (
+	"math"
+	"time"
+
+	"japanese-learning-app/internal/models"
+)
+
+// FSRSReview is one graded review in a card's history
+type FSRSReview struct {
+	Grade      Grade
+	ReviewedAt time.Time
+}
+
+// FitMetrics measure how well FSRS weights predict recall: the mean log-loss
+// and the root mean square error of the predicted chance of recall, over
+// the reviews made at least a day after the previous one
+type FitMetrics struct {
+	LogLoss float64 `json:"log_loss"`
+	RMSE    float64 `json:"rmse"`
+	Reviews int     `json:"reviews"`
+}
+
+// FitOptions control the gradient descent of FitWeights
+type FitOptions struct {
+	Iterations   int
+	LearningRate float64
+}
+
+// DefaultFitOptions suit a few thousand to a few hundred thousand reviews
+var DefaultFitOptions = FitOptions{Iterations: 150, LearningRate: 0.02}
+
+// fsrsBounds keep each weight within the range FSRS-5 allows for it
+var fsrsBounds = [FSRSWeightCount][2]float64{
+	{0.01, 100}, {0.01, 100}, {0.01, 100}, {0.01, 100},
+	{1, 10}, {0.001, 4}, {0.001, 4}, {0.001, 0.75},
+	{0, 4.5}, {0, 0.8}, {0.001, 3.5},
+	{0.001, 5}, {0.001, 0.25}, {0.001, 0.9}, {0, 4},
+	{0, 1}, {1, 6}, {0, 2}, {0, 2},
+}
+
+// EvaluateWeights scores weights on the review histories of a user's cards,
+// each in the order the reviews happened
+func EvaluateWeights(weights []float64, histories [][]FSRSReview) FitMetrics {
+	f := NewFSRS(FSRSParams{Weights: weights})
+	var m FitMetrics
+	var squared float64
+	for _, history := range histories {
+		var card models.SRSCard
+		for i, r := range history {
+			if i > 0 {
+				elapsed := r.ReviewedAt.Sub(history[i-1].ReviewedAt).Hours() / 24
+				if elapsed >= 1 {
+					p := math.Min(math.Max(retrievability(elapsed, card.Stability), 1e-6), 1-1e-6)
+					y := 0.0
+					if r.Grade.Passed() {
+						y = 1
+					}
+					m.LogLoss -= y*math.Log(p) + (1-y)*math.Log(1-p)
+					squared += (y - p) * (y - p)
+					m.Reviews++
+				}
+			}
+			card.Stability, card.Difficulty = f.memory(&card, r.Grade, r.ReviewedAt)
+			reviewed := r.ReviewedAt
+			card.LastReviewedAt = &reviewed
+		}
+	}
+	if m.Reviews > 0 {
+		m.LogLoss /= float64(m.Reviews)
+		m.RMSE = math.Sqrt(squared / float64(m.Reviews))
+	}
+	return m
+}
+
+// FitWeights fits FSRS weights to the review histories by gradient descent
+// on the log-loss, starting from start. It uses Adam with numerical
+// gradients and keeps every weight within its allowed range.
+func FitWeights(start []float64, histories [][]FSRSReview, opts FitOptions) []float64 {
+	const (
+		beta1   = 0.9
+		beta2   = 0.999
+		epsilon = 1e-8
+	)
+	w := make([]float64, FSRSWeightCount)
+	for i := range w {
+		w[i] = clampWeight(i, start[i])
+	}
+	best, bestLoss := append([]float64(nil), w...), EvaluateWeights(w, histories).LogLoss
+
+	m := make([]float64, FSRSWeightCount)
+	v := make([]float64, FSRSWeightCount)
+	for t := 1; t <= opts.Iterations; t++ {
+		grad := gradient(w, histories)
+		for i := range w {
+			m[i] = beta1*m[i] + (1-beta1)*grad[i]
+			v[i] = beta2*v[i] + (1-beta2)*grad[i]*grad[i]
+			mHat := m[i] / (1 - math.Pow(beta1, float64(t)))
+			vHat := v[i] / (1 - math.Pow(beta2, float64(t)))
+			w[i] = clampWeight(i, w[i]-opts.LearningRate*mHat/(math.Sqrt(vHat)+epsilon))
+		}
+		if loss := EvaluateWeights(w, histories).LogLoss; loss < bestLoss {
+			best, bestLoss = append(best[:0], w...), loss
+		}
+	}
+	return best
+}
+
+// gradient estimates the gradient of the log-loss by central differences
+func gradient(w []float64, histories [][]FSRSReview) []float64 {
+	grad := make([]float64, len(w))
+	probe := append([]float64(nil), w...)
+	for i := range w {
+		h := 1e-4 * math.Max(1, math.Abs(w[i]))
+		probe[i] = w[i] + h
+		up := EvaluateWeights(probe, histories).LogLoss
+		probe[i] = w[i] - h
+		down := EvaluateWeights(probe, histories).LogLoss
+		probe[i] = w[i]
+		grad[i] = (up - down) / (2 * h)
+	}
+	return grad
+}
+
+func clampWeight(i int, w float64) float64 {
+	return math.Min(math.Max(w, fsrsBounds[i][0]), fsrsBounds[i][1])
+}
@@ -0,0 +1,176 @@
+package srs
+
+import (
+	"math"
+	"math/rand/v2"
+	"slices"
+	"time"
+
+	"japanese-learning-app/internal/models"
+)
+
+// ForecastRuns is how many simulations a forecast averages by default
+const ForecastRuns = 20
+
+// ForecastDay is the projected work of one study day. Scheduled counts the
+// cards due that day as things stand; the rest are simulated averages.
+type ForecastDay struct {
+	Date      time.Time `json:"date"` // When the study day begins
+	Scheduled int       `json:"scheduled"`
+	Reviews   float64   `json:"reviews"`  // Review cards studied
+	Lapses    float64   `json:"lapses"`   // Reviews expected to be forgotten
+	New       float64   `json:"new"`      // New cards started
+	Learning  float64   `json:"learning"` // Learning and relearning steps
+	Backlog   float64   `json:"backlog"`  // Reviews due but over the daily limit
+}
+
+// ForecastOptions set up a forecast
+type ForecastOptions struct {
+	Days      int
+	Retention float64 // Chance of recalling a review card
+	Study     StudySettings
+
+	// Cards already studied today, which count against today's limits
+	NewStudied     int
+	ReviewsStudied int
+
+	// Hypothetical new cards added behind the existing ones
+	ExtraNew int
+
+	// Simulations to average, ForecastRuns if 0
+	Runs int
+}
+
+// Forecast projects the daily workload of the given cards from now on. Each
+// simulation studies the cards day by day within the daily limits: reviews
+// are recalled with the given retention and graded good, or else forgotten;
+// learning steps are always graded good.
+func Forecast(s Scheduler, cards []models.SRSCard, opts ForecastOptions, now time.Time) []ForecastDay {
+	starts := make([]time.Time, opts.Days+1)
+	starts[0] = opts.Study.DayStart(now)
+	for d := 1; d <= opts.Days; d++ {
+		starts[d] = opts.Study.DayEnd(starts[d-1])
+	}
+	days := make([]ForecastDay, opts.Days)
+	for d := range days {
+		days[d].Date = starts[d]
+	}
+
+	for _, card := range cards {
+		if card.State == models.CardStateNew {
+			continue
+		}
+		// Overdue cards count today
+		for d := range days {
+			if card.DueDate.Before(starts[d+1]) {
+				days[d].Scheduled++
+				break
+			}
+		}
+	}
+
+	runs := opts.Runs
+	if runs <= 0 {
+		runs = ForecastRuns
+	}
+	rng := rand.New(rand.NewPCG(1, 2))
+	for range runs {
+		simulate(s, cards, opts, now, starts, days, rng)
+	}
+	for d := range days {
+		days[d].Reviews = round1(days[d].Reviews / float64(runs))
+		days[d].Lapses = round1(days[d].Lapses / float64(runs))
+		days[d].New = round1(days[d].New / float64(runs))
+		days[d].Learning = round1(days[d].Learning / float64(runs))
+		days[d].Backlog = round1(days[d].Backlog / float64(runs))
+	}
+	return days
+}
+
+// simulate adds one simulation of the cards to the day totals
+func simulate(s Scheduler, cards []models.SRSCard, opts ForecastOptions, now time.Time, starts []time.Time, days []ForecastDay, rng *rand.Rand) {
+	var active, fresh []*models.SRSCard
+	for _, card := range cards {
+		c := card
+		if c.State == models.CardStateNew {
+			fresh = append(fresh, &c)
+		} else {
+			active = append(active, &c)
+		}
+	}
+	slices.SortStableFunc(fresh, func(a, b *models.SRSCard) int { return a.DueDate.Compare(b.DueDate) })
+	extra := opts.ExtraNew
+	review := func(c *models.SRSCard, grade Grade, at time.Time) {
+		s.Schedule(c, grade, at)
+		c.LastReviewedAt = &at
+	}
+
+	for d := range days {
+		start, end := starts[d], starts[d+1]
+		newLeft, reviewsLeft := opts.Study.NewCardsPerDay, opts.Study.MaxReviewsPerDay
+		if d == 0 {
+			start = now
+			newLeft -= opts.NewStudied
+			reviewsLeft -= opts.ReviewsStudied
+		}
+
+		var due []*models.SRSCard
+		for _, c := range active {
+			if c.State == models.CardStateReview && c.DueDate.Before(end) {
+				due = append(due, c)
+			}
+		}
+		slices.SortStableFunc(due, func(a, b *models.SRSCard) int { return a.DueDate.Compare(b.DueDate) })
+		if over := len(due) - max(reviewsLeft, 0); over > 0 {
+			days[d].Backlog += float64(over)
+			due = due[:len(due)-over]
+		}
+		for _, c := range due {
+			at := c.DueDate
+			if at.Before(start) {
+				at = start
+			}
+			grade := Good
+			if rng.Float64() >= opts.Retention {
+				grade = Again
+				days[d].Lapses++
+			}
+			review(c, grade, at)
+			days[d].Reviews++
+		}
+
+		// New cards also count against the review limit, as in the queue
+		newToday := min(max(newLeft, 0), max(reviewsLeft-len(due), 0))
+		for ; newToday > 0 && (len(fresh) > 0 || extra > 0); newToday-- {
+			var c *models.SRSCard
+			if len(fresh) > 0 {
+				c, fresh = fresh[0], fresh[1:]
+			} else {
+				c = &models.SRSCard{State: models.CardStateNew, EaseFactor: DefaultSM2Settings.StartingEase, IntervalDays: 1}
+				extra--
+			}
+			c.DueDate = start
+			active = append(active, c)
+			days[d].New++
+		}
+
+		for _, c := range active {
+			for c.State != models.CardStateReview && c.DueDate.Before(end) {
+				at := c.DueDate
+				if at.Before(start) {
+					at = start
+				}
+				review(c, Good, at)
+				days[d].Learning++
+				if !c.DueDate.After(at) {
+					break
+				}
+			}
+		}
+	}
+}
+
+// round1 rounds to one decimal place
+func round1(x float64) float64 {
+	return math.Round(x*10) / 10
+}
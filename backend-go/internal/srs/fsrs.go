@@ -0,0 +1,307 @@
+package srs
+
+import (
+	"math"
+	"time"
+
+	"japanese-learning-app/internal/models"
+)
+
+// FSRS-5 forgetting curve: R(t, S) = (1 + factor*t/S)^decay, which makes S
+// the number of days after which recall drops to 90%
+const (
+	fsrsDecay  = -0.5
+	fsrsFactor = 19.0 / 81.0
+)
+
+// FSRSWeightCount is the number of FSRS-5 model weights
+const FSRSWeightCount = 19
+
+// DefaultFSRSWeights are the FSRS-5 weights trained on a large body of Anki
+// reviews, used until a user's own weights are set
+var DefaultFSRSWeights = []float64{
+	0.40255, 1.18385, 3.173, 15.69105, 7.1949, 0.5345, 1.4604, 0.0046, 1.54575, 0.1192,
+	1.01925, 1.9395, 0.11, 0.29605, 2.2698, 0.2315, 2.9898, 0.51655, 0.6621,
+}
+
+// Bounds of the desired retention setting
+const (
+	DefaultDesiredRetention = 0.9
+	MinDesiredRetention     = 0.7
+	MaxDesiredRetention     = 0.99
+)
+
+// FSRSParams are the settings of the FSRS scheduler
+type FSRSParams struct {
+	Weights          []float64
+	DesiredRetention float64 // Probability of recall at which a card falls due
+	LearningSteps    []time.Duration
+	RelearningSteps  []time.Duration
+	MaximumInterval  int // Days
+}
+
+// DefaultFSRSParams returns the default weights and retention, with the same
+// (re)learning steps and maximum interval as SM-2
+func DefaultFSRSParams() FSRSParams {
+	return FSRSParams{
+		Weights:          DefaultFSRSWeights,
+		DesiredRetention: DefaultDesiredRetention,
+		LearningSteps:    DefaultSM2Settings.LearningSteps,
+		RelearningSteps:  DefaultSM2Settings.RelearningSteps,
+		MaximumInterval:  DefaultSM2Settings.MaximumInterval,
+	}
+}
+
+// UserFSRSParams returns the FSRS settings from the user's learning
+// preferences. Unset or invalid values fall back to the defaults.
+func UserFSRSParams(user *models.User) FSRSParams {
+	params := DefaultFSRSParams()
+	if w, ok := ParseWeights(user.LearningPreferences[models.PrefFSRSWeights]); ok {
+		params.Weights = w
+	}
+	if r := user.PreferenceFloat(models.PrefDesiredRetention, 0); ValidRetention(r) {
+		params.DesiredRetention = r
+	}
+	return params
+}
+
+// ParseWeights reads FSRS weights in their JSON form, a list of numbers
+func ParseWeights(v interface{}) ([]float64, bool) {
+	var weights []float64
+	switch v := v.(type) {
+	case []float64:
+		weights = v
+	case []interface{}:
+		weights = make([]float64, 0, len(v))
+		for _, x := range v {
+			f, ok := x.(float64)
+			if !ok {
+				return nil, false
+			}
+			weights = append(weights, f)
+		}
+	default:
+		return nil, false
+	}
+	if len(weights) != FSRSWeightCount {
+		return nil, false
+	}
+	for _, w := range weights {
+		if math.IsNaN(w) || math.IsInf(w, 0) {
+			return nil, false
+		}
+	}
+	return weights, true
+}
+
+// ValidRetention reports whether r is an allowed desired retention
+func ValidRetention(r float64) bool {
+	return r >= MinDesiredRetention && r <= MaxDesiredRetention
+}
+
+// FSRS schedules cards with the Free Spaced Repetition Scheduler (FSRS-5).
+// It models each card's memory by its stability and difficulty and makes it
+// due when the predicted chance of recall drops to the desired retention.
+type FSRS struct {
+	Params FSRSParams
+}
+
+// NewFSRS creates an FSRS scheduler
+func NewFSRS(params FSRSParams) *FSRS {
+	return &FSRS{Params: params}
+}
+
+// Name implements Scheduler
+func (f *FSRS) Name() string {
+	return SchedulerFSRS
+}
+
+// Schedule applies a graded review at time now to the card's scheduling state
+func (f *FSRS) Schedule(card *models.SRSCard, grade Grade, now time.Time) {
+	if card.State == models.CardStateReview {
+		f.review(card, grade, now)
+		return
+	}
+
+	card.Stability, card.Difficulty = f.memory(card, grade, now)
+	steps := f.Params.RelearningSteps
+	if card.State != models.CardStateRelearning {
+		steps = f.Params.LearningSteps
+		if card.State != models.CardStateLearning {
+			card.State = models.CardStateLearning
+			card.LearningStep = 0
+		}
+	}
+
+	switch grade {
+	case Again:
+		card.LearningStep = 0
+	case Hard:
+		// Repeat the current step; on the first step, wait halfway to the second
+	case Good:
+		card.LearningStep++
+	case Easy:
+		f.graduate(card, now)
+		return
+	}
+	if card.LearningStep >= len(steps) {
+		f.graduate(card, now)
+		return
+	}
+
+	delay := steps[card.LearningStep]
+	if grade == Hard && card.LearningStep == 0 && len(steps) > 1 {
+		delay = (steps[0] + steps[1]) / 2
+	}
+	card.DueDate = now.Add(delay)
+}
+
+// graduate turns a (re)learning card into a review card due when its recall
+// drops to the desired retention
+func (f *FSRS) graduate(card *models.SRSCard, now time.Time) {
+	card.State = models.CardStateReview
+	card.LearningStep = 0
+	card.IntervalDays = f.interval(card.Stability)
+	card.DueDate = now.AddDate(0, 0, card.IntervalDays)
+}
+
+// review schedules a card in the review state
+func (f *FSRS) review(card *models.SRSCard, grade Grade, now time.Time) {
+	if grade == Again {
+		card.Stability, card.Difficulty = f.memory(card, grade, now)
+		card.Lapses++
+		card.RepetitionCount = 0
+		card.IntervalDays = f.interval(card.Stability)
+		if len(f.Params.RelearningSteps) > 0 {
+			card.State = models.CardStateRelearning
+			card.LearningStep = 0
+			card.DueDate = now.Add(f.Params.RelearningSteps[0])
+		} else {
+			card.DueDate = now.AddDate(0, 0, card.IntervalDays)
+		}
+		return
+	}
+
+	// Keep hard < good < easy, which the model alone does not guarantee
+	hardS, hardD := f.memory(card, Hard, now)
+	goodS, goodD := f.memory(card, Good, now)
+	easyS, easyD := f.memory(card, Easy, now)
+	hard := f.interval(hardS)
+	good := f.clamp(max(f.interval(goodS), hard+1))
+	easy := f.clamp(max(f.interval(easyS), good+1))
+
+	card.RepetitionCount++
+	switch grade {
+	case Hard:
+		card.Stability, card.Difficulty, card.IntervalDays = hardS, hardD, hard
+	case Good:
+		card.Stability, card.Difficulty, card.IntervalDays = goodS, goodD, good
+	case Easy:
+		card.Stability, card.Difficulty, card.IntervalDays = easyS, easyD, easy
+	}
+	card.DueDate = now.AddDate(0, 0, card.IntervalDays)
+}
+
+// memory returns the card's stability and difficulty after a review
+func (f *FSRS) memory(card *models.SRSCard, grade Grade, now time.Time) (stability, difficulty float64) {
+	if card.Stability <= 0 {
+		return f.initStability(grade), clampDifficulty(f.initDifficulty(grade))
+	}
+
+	difficulty = f.nextDifficulty(card.Difficulty, grade)
+	var elapsed float64
+	if card.LastReviewedAt != nil {
+		elapsed = math.Max(0, now.Sub(*card.LastReviewedAt).Hours()/24)
+	}
+	if elapsed < 1 {
+		return f.shortTermStability(card.Stability, grade), difficulty
+	}
+	r := retrievability(elapsed, card.Stability)
+	if grade == Again {
+		return f.forgetStability(card.Difficulty, card.Stability, r), difficulty
+	}
+	return f.recallStability(card.Difficulty, card.Stability, r, grade), difficulty
+}
+
+// retrievability is the chance of recalling a card elapsed days after its
+// last review
+func retrievability(elapsed, stability float64) float64 {
+	return math.Pow(1+fsrsFactor*elapsed/stability, fsrsDecay)
+}
+
+// interval is the number of days until recall drops to the desired retention
+func (f *FSRS) interval(stability float64) int {
+	days := stability / fsrsFactor * (math.Pow(f.Params.DesiredRetention, 1/fsrsDecay) - 1)
+	return f.clamp(int(math.Round(days)))
+}
+
+func (f *FSRS) clamp(days int) int {
+	return min(max(days, 1), f.Params.MaximumInterval)
+}
+
+func (f *FSRS) initStability(grade Grade) float64 {
+	return math.Max(f.Params.Weights[grade-1], 0.1)
+}
+
+func (f *FSRS) initDifficulty(grade Grade) float64 {
+	w := f.Params.Weights
+	return w[4] - math.Exp(w[5]*float64(grade-1)) + 1
+}
+
+// nextDifficulty moves difficulty up for Again/Hard and down for Easy,
+// less so near the ends of the scale, with a slight pull back towards the
+// difficulty of a card first answered Easy
+func (f *FSRS) nextDifficulty(d float64, grade Grade) float64 {
+	w := f.Params.Weights
+	next := d - w[6]*float64(grade-3)*(10-d)/9
+	return clampDifficulty(w[7]*f.initDifficulty(Easy) + (1-w[7])*next)
+}
+
+func (f *FSRS) recallStability(d, s, r float64, grade Grade) float64 {
+	w := f.Params.Weights
+	bonus := 1.0
+	switch grade {
+	case Hard:
+		bonus = w[15]
+	case Easy:
+		bonus = w[16]
+	}
+	return s * (1 + math.Exp(w[8])*(11-d)*math.Pow(s, -w[9])*(math.Exp(w[10]*(1-r))-1)*bonus)
+}
+
+func (f *FSRS) forgetStability(d, s, r float64) float64 {
+	w := f.Params.Weights
+	forgotten := w[11] * math.Pow(d, -w[12]) * (math.Pow(s+1, w[13]) - 1) * math.Exp(w[14]*(1-r))
+	// Forgetting never leaves a card more stable than a same-day Again would
+	return math.Min(forgotten, s/math.Exp(w[17]*w[18]))
+}
+
+// shortTermStability updates stability for reviews on the same day
+func (f *FSRS) shortTermStability(s float64, grade Grade) float64 {
+	w := f.Params.Weights
+	inc := math.Exp(w[17] * (float64(grade) - 3 + w[18]))
+	if grade >= Good {
+		inc = math.Max(inc, 1)
+	}
+	return s * inc
+}
+
+func clampDifficulty(d float64) float64 {
+	return math.Min(math.Max(d, 1), 10)
+}
+
+// convertSM2 estimates the memory state of a card scheduled by SM-2 that has
+// no review history: its interval stands for the stability, and the
+// difficulty is the one at which FSRS would grow the interval by the ease
+func (f *FSRS) convertSM2(card *models.SRSCard) {
+	if card.State != models.CardStateReview {
+		card.Stability = f.initStability(Good)
+		card.Difficulty = clampDifficulty(f.initDifficulty(Good))
+		return
+	}
+	w := f.Params.Weights
+	s := math.Max(float64(card.IntervalDays), 0.1)
+	growth := math.Exp(w[8]) * math.Pow(s, -w[9]) * (math.Exp(w[10]*(1-DefaultDesiredRetention)) - 1)
+	card.Stability = s
+	card.Difficulty = clampDifficulty(11 - (card.EaseFactor-1)/growth)
+}
@@ -0,0 +1,51 @@
+package srs
+
+import (
+	"japanese-learning-app/internal/models"
+)
+
+// What happens to a card that becomes a leech
+const (
+	LeechActionTag     = "tag"
+	LeechActionSuspend = "suspend"
+)
+
+// DefaultLeechThreshold is the number of lapses that makes a card a leech
+const DefaultLeechThreshold = 8
+
+// LeechSettings say when a card counts as a leech and what to do with it
+type LeechSettings struct {
+	Threshold int // Lapses; 0 turns leech detection off
+	Action    string
+}
+
+// UserLeechSettings reads the leech settings from the user's learning
+// preferences
+func UserLeechSettings(user *models.User) LeechSettings {
+	l := LeechSettings{
+		Threshold: max(user.PreferenceInt(models.PrefLeechThreshold, DefaultLeechThreshold), 0),
+		Action:    user.PreferenceString(models.PrefLeechAction, LeechActionTag),
+	}
+	if l.Action != LeechActionSuspend {
+		l.Action = LeechActionTag
+	}
+	return l
+}
+
+// Check tags a card that just lapsed as a leech, and suspends it if so
+// configured, when its lapses reach the threshold and then every half
+// threshold after that, as in Anki. It reports whether the card hit a leech
+// warning.
+func (l LeechSettings) Check(card *models.SRSCard) bool {
+	if l.Threshold <= 0 || card.Lapses < l.Threshold {
+		return false
+	}
+	if (card.Lapses-l.Threshold)%max(l.Threshold/2, 1) != 0 {
+		return false
+	}
+	card.IsLeech = true
+	if l.Action == LeechActionSuspend {
+		card.IsSuspended = true
+	}
+	return true
+}
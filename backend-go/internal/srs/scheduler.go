@@ -0,0 +1,120 @@
+package srs
+
+import (
+	"fmt"
+	"time"
+
+	"japanese-learning-app/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// Scheduler names, as stored in the user's learning preferences
+const (
+	SchedulerSM2  = "sm2"
+	SchedulerFSRS = "fsrs"
+)
+
+// Scheduler decides when a card is next due
+type Scheduler interface {
+	// Name is the scheduler's name in the learning preferences
+	Name() string
+	// Schedule applies a graded review at time now to the card's scheduling
+	// state. It leaves the review statistics alone.
+	Schedule(card *models.SRSCard, grade Grade, now time.Time)
+}
+
+// Review schedules a graded review of the card and updates its statistics
+func Review(s Scheduler, card *models.SRSCard, grade Grade, now time.Time) {
+	s.Schedule(card, grade, now)
+	recordStats(card, grade, now)
+}
+
+// Preview returns when the card would next be due for each grade, without
+// changing it
+func Preview(s Scheduler, card models.SRSCard, now time.Time) map[Grade]time.Time {
+	due := make(map[Grade]time.Time, 4)
+	for g := Again; g <= Easy; g++ {
+		c := card
+		s.Schedule(&c, g, now)
+		due[g] = c.DueDate
+	}
+	return due
+}
+
+// ForUser returns the scheduler the user chose, SM-2 unless set otherwise
+func ForUser(user *models.User) Scheduler {
+	if user.PreferenceString(models.PrefScheduler, SchedulerSM2) == SchedulerFSRS {
+		return NewFSRS(UserFSRSParams(user))
+	}
+	return NewSM2()
+}
+
+// ValidScheduler reports whether name is a known scheduler
+func ValidScheduler(name string) bool {
+	return name == SchedulerSM2 || name == SchedulerFSRS
+}
+
+// migrateBatchSize is how many cards Migrate reschedules at a time
+const migrateBatchSize = 500
+
+// Migrate reschedules all of the user's cards with s by replaying their
+// review history. Cards reviewed before any history was recorded keep their
+// state, converted to what s needs to schedule them. Review statistics are
+// kept as they are. It returns the number of cards migrated.
+func Migrate(tx *gorm.DB, userID uint, s Scheduler) (int, error) {
+	var cards []models.SRSCard
+	result := tx.Where("user_id = ?", userID).FindInBatches(&cards, migrateBatchSize, func(*gorm.DB, int) error {
+		ids := make([]uint, len(cards))
+		for i, card := range cards {
+			ids[i] = card.ID
+		}
+		var reviews []models.ReviewHistory
+		if err := tx.Select("card_id", "reviewed_at", "response_quality").
+			Where("card_id IN ?", ids).Order("reviewed_at").Order("id").
+			Find(&reviews).Error; err != nil {
+			return fmt.Errorf("failed to load review history: %w", err)
+		}
+		history := make(map[uint][]models.ReviewHistory, len(cards))
+		for _, r := range reviews {
+			history[r.CardID] = append(history[r.CardID], r)
+		}
+
+		for i := range cards {
+			card := &cards[i]
+			if len(history[card.ID]) > 0 {
+				replay(s, card, history[card.ID])
+			} else if fsrs, ok := s.(*FSRS); ok && card.State != models.CardStateNew {
+				fsrs.convertSM2(card)
+			}
+			if err := tx.Omit("Word").Save(card).Error; err != nil {
+				return fmt.Errorf("failed to migrate card %d: %w", card.ID, err)
+			}
+		}
+		return nil
+	})
+	return int(result.RowsAffected), result.Error
+}
+
+// replay recomputes the card's scheduling state from its review history
+func replay(s Scheduler, card *models.SRSCard, history []models.ReviewHistory) {
+	c := models.SRSCard{State: models.CardStateNew, EaseFactor: DefaultSM2Settings.StartingEase, IntervalDays: 1}
+	for _, r := range history {
+		if !Grade(r.ResponseQuality).Valid() {
+			continue
+		}
+		s.Schedule(&c, Grade(r.ResponseQuality), r.ReviewedAt)
+		reviewed := r.ReviewedAt
+		c.LastReviewedAt = &reviewed
+	}
+
+	card.State = c.State
+	card.LearningStep = c.LearningStep
+	card.EaseFactor = c.EaseFactor
+	card.IntervalDays = c.IntervalDays
+	card.RepetitionCount = c.RepetitionCount
+	card.Lapses = c.Lapses
+	card.Stability = c.Stability
+	card.Difficulty = c.Difficulty
+	card.DueDate = c.DueDate
+}
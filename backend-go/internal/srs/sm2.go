@@ -0,0 +1,201 @@
+package srs
+
+import (
+	"math"
+	"time"
+
+	"japanese-learning-app/internal/models"
+)
+
+// Grade is the answer to a review
+type Grade int
+
+// Review grades, as in Anki
+const (
+	Again Grade = 1
+	Hard  Grade = 2
+	Good  Grade = 3
+	Easy  Grade = 4
+)
+
+// Valid reports whether g is one of the four grades
+func (g Grade) Valid() bool {
+	return g >= Again && g <= Easy
+}
+
+// Passed reports whether the card was remembered
+func (g Grade) Passed() bool {
+	return g > Again
+}
+
+// SM2Settings are the deck options of Anki's SM-2 scheduler
+type SM2Settings struct {
+	LearningSteps      []time.Duration
+	RelearningSteps    []time.Duration
+	GraduatingInterval int     // Days, after the last learning step
+	EasyInterval       int     // Days, when a new card is answered Easy
+	StartingEase       float64 // Ease of a graduating card
+	MinimumEase        float64
+	EasyBonus          float64 // Extra multiplier for Easy reviews
+	HardMultiplier     float64 // Interval multiplier for Hard reviews
+	IntervalModifier   float64 // Applied to every review interval
+	LapseMultiplier    float64 // New interval after a lapse, as a share of the old one
+	MinimumInterval    int     // Days, after a lapse
+	MaximumInterval    int     // Days
+}
+
+// DefaultSM2Settings matches Anki's defaults
+var DefaultSM2Settings = SM2Settings{
+	LearningSteps:      []time.Duration{time.Minute, 10 * time.Minute},
+	RelearningSteps:    []time.Duration{10 * time.Minute},
+	GraduatingInterval: 1,
+	EasyInterval:       4,
+	StartingEase:       2.5,
+	MinimumEase:        1.3,
+	EasyBonus:          1.3,
+	HardMultiplier:     1.2,
+	IntervalModifier:   1.0,
+	LapseMultiplier:    0,
+	MinimumInterval:    1,
+	MaximumInterval:    36500,
+}
+
+// SM2 schedules cards with Anki's variant of the SM-2 algorithm
+type SM2 struct {
+	Settings SM2Settings
+}
+
+// NewSM2 creates an SM-2 scheduler with the default settings
+func NewSM2() *SM2 {
+	return &SM2{Settings: DefaultSM2Settings}
+}
+
+// Name implements Scheduler
+func (s *SM2) Name() string {
+	return SchedulerSM2
+}
+
+// Schedule applies a graded review at time now to the card's scheduling state
+func (s *SM2) Schedule(card *models.SRSCard, grade Grade, now time.Time) {
+	switch card.State {
+	case models.CardStateReview:
+		s.review(card, grade, now)
+	case models.CardStateRelearning:
+		s.learn(card, grade, now, s.Settings.RelearningSteps)
+	default:
+		if card.State != models.CardStateLearning {
+			card.State = models.CardStateLearning
+			card.LearningStep = 0
+			card.EaseFactor = s.Settings.StartingEase
+		}
+		s.learn(card, grade, now, s.Settings.LearningSteps)
+	}
+}
+
+// learn moves a (re)learning card through its steps
+func (s *SM2) learn(card *models.SRSCard, grade Grade, now time.Time, steps []time.Duration) {
+	relearning := card.State == models.CardStateRelearning
+	switch grade {
+	case Again:
+		card.LearningStep = 0
+	case Hard:
+		// Repeat the current step; on the first step, wait halfway to the second
+	case Good:
+		card.LearningStep++
+	case Easy:
+		interval := card.IntervalDays
+		if !relearning {
+			interval = s.Settings.EasyInterval
+		}
+		s.graduate(card, interval, now)
+		return
+	}
+
+	if card.LearningStep >= len(steps) {
+		interval := card.IntervalDays
+		if !relearning {
+			interval = s.Settings.GraduatingInterval
+		}
+		s.graduate(card, interval, now)
+		return
+	}
+
+	delay := steps[card.LearningStep]
+	if grade == Hard && card.LearningStep == 0 && len(steps) > 1 {
+		delay = (steps[0] + steps[1]) / 2
+	}
+	card.DueDate = now.Add(delay)
+}
+
+// graduate turns a (re)learning card into a review card due in interval days
+func (s *SM2) graduate(card *models.SRSCard, interval int, now time.Time) {
+	card.State = models.CardStateReview
+	card.LearningStep = 0
+	card.IntervalDays = s.clamp(interval)
+	card.DueDate = now.AddDate(0, 0, card.IntervalDays)
+}
+
+// review schedules a card in the review state
+func (s *SM2) review(card *models.SRSCard, grade Grade, now time.Time) {
+	st := s.Settings
+	interval := float64(max(card.IntervalDays, 1))
+	// Days overdue count towards the next interval, as in Anki
+	overdue := math.Max(0, now.Sub(card.DueDate).Hours()/24)
+
+	switch grade {
+	case Again:
+		card.Lapses++
+		card.RepetitionCount = 0
+		card.EaseFactor = roundEase(math.Max(st.MinimumEase, card.EaseFactor-0.20))
+		card.IntervalDays = s.clamp(max(st.MinimumInterval, int(math.Round(interval*st.LapseMultiplier))))
+		if len(st.RelearningSteps) > 0 {
+			card.State = models.CardStateRelearning
+			card.LearningStep = 0
+			card.DueDate = now.Add(st.RelearningSteps[0])
+		} else {
+			card.DueDate = now.AddDate(0, 0, card.IntervalDays)
+		}
+		return
+	}
+
+	hard := s.clamp(max(int(math.Round(interval*st.HardMultiplier*st.IntervalModifier)), int(interval)+1))
+	good := s.clamp(max(int(math.Round((interval+overdue/2)*card.EaseFactor*st.IntervalModifier)), hard+1))
+	easy := s.clamp(max(int(math.Round((interval+overdue)*card.EaseFactor*st.EasyBonus*st.IntervalModifier)), good+1))
+
+	card.RepetitionCount++
+	switch grade {
+	case Hard:
+		card.EaseFactor = math.Max(st.MinimumEase, card.EaseFactor-0.15)
+		card.IntervalDays = hard
+	case Good:
+		card.IntervalDays = good
+	case Easy:
+		card.EaseFactor += 0.15
+		card.IntervalDays = easy
+	}
+	card.EaseFactor = roundEase(card.EaseFactor)
+	card.DueDate = now.AddDate(0, 0, card.IntervalDays)
+}
+
+// roundEase keeps the ease factor to the two decimals the database stores
+func roundEase(ease float64) float64 {
+	return math.Round(ease*100) / 100
+}
+
+func (s *SM2) clamp(days int) int {
+	return min(max(days, 1), s.Settings.MaximumInterval)
+}
+
+// recordStats updates a card's review counters
+func recordStats(card *models.SRSCard, grade Grade, now time.Time) {
+	card.TotalReviews++
+	if grade.Passed() {
+		card.CorrectReviews++
+		card.CurrentStreak++
+		card.LongestStreak = max(card.LongestStreak, card.CurrentStreak)
+	} else {
+		card.CurrentStreak = 0
+	}
+	reviewed := now
+	card.LastReviewedAt = &reviewed
+}
@@ -0,0 +1,52 @@
+package textproc
+
+import "strings"
+
+// ToHiragana converts katakana in s to hiragana, leaving everything else as is
+func ToHiragana(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'ァ' && r <= 'ヶ' {
+			return r - 0x60
+		}
+		return r
+	}, s)
+}
+
+// ToKatakana converts hiragana in s to katakana, leaving everything else as is
+func ToKatakana(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'ぁ' && r <= 'ゖ' {
+			return r + 0x60
+		}
+		return r
+	}, s)
+}
+
+// IsKanji reports whether r is written as a kanji for reading purposes. The
+// iteration mark 々 and the counter ヶ carry a reading of their own, so they
+// are treated as kanji here.
+func IsKanji(r rune) bool {
+	switch {
+	case r >= 0x4E00 && r <= 0x9FFF, // CJK Unified Ideographs
+		r >= 0x3400 && r <= 0x4DBF,   // Extension A
+		r >= 0x20000 && r <= 0x2FA1F, // Extensions B+ and compatibility supplement
+		r >= 0xF900 && r <= 0xFAFF:   // Compatibility Ideographs
+		return true
+	}
+	return r == '々' || r == '〆' || r == 'ヶ' || r == 'ヵ'
+}
+
+// IsKana reports whether r is hiragana, katakana or the prolonged sound mark
+func IsKana(r rune) bool {
+	return (r >= 'ぁ' && r <= 'ゟ') || (r >= 'ァ' && r <= 'ヿ' && r != 'ヶ' && r != 'ヵ')
+}
+
+// ContainsKanji reports whether s contains at least one kanji
+func ContainsKanji(s string) bool {
+	for _, r := range s {
+		if IsKanji(r) {
+			return true
+		}
+	}
+	return false
+}
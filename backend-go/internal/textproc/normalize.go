@@ -0,0 +1,209 @@
+package textproc
+
+import "strings"
+
+// Normalized is a normalized copy of a text together with the mapping back to
+// the original. Offsets are rune (character) offsets, the same unit used by
+// BookAnnotation.StartPosition / EndPosition.
+type Normalized struct {
+	Text string
+
+	// origin[i] is the first original rune that produced normalized rune i.
+	// origin has one extra trailing entry holding the original length so
+	// that exclusive end offsets can be mapped as well.
+	origin []int
+}
+
+// Normalize prepares extracted book text for tokenizing without changing what
+// a reader sees. It folds half-width katakana and full-width ASCII to their
+// usual forms, expands the kana iteration marks ゝゞヽヾ into the kana they
+// repeat (々 is left alone because tokenizer dictionaries already know it),
+// and replaces vertical-text presentation forms such as ︒︑ with their
+// horizontal equivalents.
+func Normalize(text string) *Normalized {
+	src := []rune(text)
+	out := make([]rune, 0, len(src))
+	origin := make([]int, 0, len(src)+1)
+
+	emit := func(r rune, from int) {
+		out = append(out, r)
+		origin = append(origin, from)
+	}
+
+	for i := 0; i < len(src); i++ {
+		r := src[i]
+		switch {
+		case r >= 0xFF61 && r <= 0xFF9F:
+			// Half-width katakana; a following sound mark is merged into it
+			if k, ok := halfWidthKana[r]; ok {
+				if i+1 < len(src) {
+					if merged, ok := applySoundMark(k, src[i+1]); ok {
+						emit(merged, i)
+						i++
+						continue
+					}
+				}
+				emit(k, i)
+				continue
+			}
+			emit(r, i)
+
+		case r >= 0xFF01 && r <= 0xFF5E:
+			// Full-width ASCII
+			emit(r-0xFEE0, i)
+
+		case r == 'ゝ' || r == 'ゞ' || r == 'ヽ' || r == 'ヾ':
+			emit(expandIterationMark(r, out), i)
+
+		default:
+			if h, ok := verticalForms[r]; ok {
+				emit(h, i)
+				continue
+			}
+			emit(r, i)
+		}
+	}
+	origin = append(origin, len(src))
+
+	return &Normalized{Text: string(out), origin: origin}
+}
+
+// Len returns the length of the normalized text in runes
+func (n *Normalized) Len() int {
+	return len(n.origin) - 1
+}
+
+// OriginalOffset maps a rune offset in the normalized text to the
+// corresponding rune offset in the original text
+func (n *Normalized) OriginalOffset(pos int) int {
+	if pos <= 0 {
+		return 0
+	}
+	if pos >= len(n.origin) {
+		pos = len(n.origin) - 1
+	}
+	return n.origin[pos]
+}
+
+// OriginalSpan maps a half-open normalized range [start, end) to the range of
+// original characters it was produced from
+func (n *Normalized) OriginalSpan(start, end int) (int, int) {
+	origStart := n.OriginalOffset(start)
+	if end <= start {
+		return origStart, origStart
+	}
+	return origStart, n.OriginalOffset(end)
+}
+
+// NormalizedOffset maps a rune offset in the original text to the first
+// normalized rune produced at or after it
+func (n *Normalized) NormalizedOffset(pos int) int {
+	lo, hi := 0, len(n.origin)-1
+	for lo < hi {
+		mid := (lo + hi) / 2
+		if n.origin[mid] < pos {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	return lo
+}
+
+// NormalizeString is a convenience wrapper for callers that only need the
+// normalized text, e.g. when matching user input against dictionary entries
+func NormalizeString(text string) string {
+	return Normalize(text).Text
+}
+
+var halfWidthKana = func() map[rune]rune {
+	half := []rune("｡｢｣､･ｦｧｨｩｪｫｬｭｮｯｰｱｲｳｴｵｶｷｸｹｺｻｼｽｾｿﾀﾁﾂﾃﾄﾅﾆﾇﾈﾉﾊﾋﾌﾍﾎﾏﾐﾑﾒﾓﾔﾕﾖﾗﾘﾙﾚﾛﾜﾝﾞﾟ")
+	full := []rune("。「」、・ヲァィゥェォャュョッーアイウエオカキクケコサシスセソタチツテトナニヌネノハヒフヘホマミムメモヤユヨラリルレロワン゛゜")
+	m := make(map[rune]rune, len(half))
+	for i, r := range half {
+		m[r] = full[i]
+	}
+	return m
+}()
+
+// verticalForms maps the vertical presentation forms (U+FE10–FE19,
+// U+FE30–FE48) to the characters they are drawn for. Forms of ASCII
+// punctuation map straight to ASCII to match the full-width folding.
+var verticalForms = map[rune]rune{
+	'︐': ',', '︑': '、', '︒': '。', '︓': ':', '︔': ';',
+	'︕': '!', '︖': '?', '︗': '〖', '︘': '〗', '︙': '…',
+	'︰': '‥', '︱': '—', '︲': '–', '︳': '_', '︴': '_',
+	'︵': '(', '︶': ')', '︷': '{', '︸': '}', '︹': '〔',
+	'︺': '〕', '︻': '【', '︼': '】', '︽': '《', '︾': '》',
+	'︿': '〈', '﹀': '〉', '﹁': '「', '﹂': '」', '﹃': '『',
+	'﹄': '』', '﹇': '[', '﹈': ']',
+}
+
+// voiceable lists the kana whose voiced form is the next code point
+const voiceable = "かきくけこさしすせそたちつてとはひふへほカキクケコサシスセソタチツテトハヒフヘホ"
+
+// semiVoiceable lists the kana whose semi-voiced form is two code points on
+const semiVoiceable = "はひふへほハヒフヘホ"
+
+// applySoundMark combines a kana with a following half-width (or combining)
+// dakuten / handakuten
+func applySoundMark(k, mark rune) (rune, bool) {
+	switch mark {
+	case 'ﾞ', '゙':
+		if k == 'ウ' {
+			return 'ヴ', true
+		}
+		if strings.ContainsRune(voiceable, k) {
+			return k + 1, true
+		}
+	case 'ﾟ', '゚':
+		if strings.ContainsRune(semiVoiceable, k) {
+			return k + 2, true
+		}
+	}
+	return 0, false
+}
+
+// expandIterationMark returns the kana an iteration mark stands for, based on
+// the previous normalized rune. Marks that cannot be resolved are returned
+// unchanged.
+func expandIterationMark(mark rune, prev []rune) rune {
+	if len(prev) == 0 {
+		return mark
+	}
+	base := unvoiced(prev[len(prev)-1])
+
+	hiragana := base >= 'ぁ' && base <= 'ゖ'
+	katakana := base >= 'ァ' && base <= 'ヺ'
+	switch mark {
+	case 'ゝ', 'ゞ':
+		if !hiragana {
+			return mark
+		}
+	case 'ヽ', 'ヾ':
+		if !katakana {
+			return mark
+		}
+	}
+
+	if mark == 'ゞ' || mark == 'ヾ' {
+		if v, ok := applySoundMark(base, 'ﾞ'); ok {
+			return v
+		}
+	}
+	return base
+}
+
+// unvoiced strips a dakuten or handakuten from a kana
+func unvoiced(r rune) rune {
+	if r == 'ヴ' {
+		return 'ウ'
+	}
+	if strings.ContainsRune(voiceable, r-1) {
+		return r - 1
+	}
+	if strings.ContainsRune(semiVoiceable, r-2) {
+		return r - 2
+	}
+	return r
+}
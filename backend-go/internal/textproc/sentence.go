@@ -0,0 +1,150 @@
+package textproc
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Sentence is a half-open range [Start, End) of rune offsets into a text
+type Sentence struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+const (
+	terminators = "。！？!?｡"
+	ellipses    = "…‥"
+	openQuotes  = "「『（〈《【〔“‘(［["
+	closeQuotes = "」』）〉》】〕”’)］]"
+)
+
+// SplitSentences splits Japanese text into sentences.
+//
+// A sentence ends after a run of 。！？ (or their ASCII forms) and any closing
+// brackets that follow it, and always at a line break. Terminators inside
+// 「」『』 and other brackets do not end the surrounding sentence, so
+// 「来たよ。」と言った。 stays whole; a quotation standing on its own ends
+// where it closes. Ellipses (… ‥ ...) only end a sentence when followed by a
+// line break, the end of the text or a new quotation. Spaces inside a
+// sentence are kept; surrounding whitespace is not part of any sentence.
+func SplitSentences(text []rune) []Sentence {
+	var sentences []Sentence
+	start, depth := -1, 0
+
+	finish := func(end int) {
+		if start < 0 {
+			return
+		}
+		for end > start && unicode.IsSpace(text[end-1]) {
+			end--
+		}
+		if end > start {
+			sentences = append(sentences, Sentence{Start: start, End: end})
+		}
+		start, depth = -1, 0
+	}
+
+	for i := 0; i < len(text); i++ {
+		r := text[i]
+		if r == '\n' || r == '\r' || r == ' ' {
+			finish(i)
+			continue
+		}
+		if start < 0 {
+			if unicode.IsSpace(r) {
+				continue
+			}
+			start = i
+		}
+
+		switch {
+		case strings.ContainsRune(openQuotes, r):
+			depth++
+
+		case strings.ContainsRune(closeQuotes, r):
+			if depth > 0 {
+				depth--
+			}
+			if depth == 0 && standsAlone(text, start, i) && endsHere(text, i+1) {
+				finish(i + 1)
+			}
+
+		case depth > 0:
+			// Inside a quotation nothing ends the outer sentence
+
+		case strings.ContainsRune(terminators, r):
+			end := skipRun(text, i+1, terminators+ellipses)
+			end = skipRun(text, end, closeQuotes)
+			finish(end)
+			i = end - 1
+
+		case strings.ContainsRune(ellipses, r) || isDots(text, i):
+			end := skipRun(text, i+1, ellipses+".")
+			if end < len(text) && strings.ContainsRune(terminators, text[end]) {
+				// Handled as a terminator on the next iteration
+				i = end - 1
+				continue
+			}
+			end = skipRun(text, end, closeQuotes)
+			if endsHere(text, end) {
+				finish(end)
+			}
+			i = end - 1
+		}
+	}
+	finish(len(text))
+	return sentences
+}
+
+// SentenceAt returns the index of the sentence containing pos, or -1
+func SentenceAt(sentences []Sentence, pos int) int {
+	lo, hi := 0, len(sentences)
+	for lo < hi {
+		mid := (lo + hi) / 2
+		if sentences[mid].End <= pos {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	if lo < len(sentences) && sentences[lo].Start <= pos {
+		return lo
+	}
+	return -1
+}
+
+// standsAlone reports whether the quotation closing at end is the whole
+// sentence so far, i.e. the sentence began with its opening bracket
+func standsAlone(text []rune, start, end int) bool {
+	return start < end && strings.ContainsRune(openQuotes, text[start])
+}
+
+// endsHere reports whether a sentence can end before position i: at the end
+// of the text, at a line break, or where a new quotation begins
+func endsHere(text []rune, i int) bool {
+	for ; i < len(text); i++ {
+		r := text[i]
+		switch {
+		case r == '\n' || r == '\r' || r == ' ':
+			return true
+		case unicode.IsSpace(r):
+			continue
+		default:
+			return strings.ContainsRune(openQuotes, r)
+		}
+	}
+	return true
+}
+
+// skipRun returns the first position at or after i holding a rune not in set
+func skipRun(text []rune, i int, set string) int {
+	for i < len(text) && strings.ContainsRune(set, text[i]) {
+		i++
+	}
+	return i
+}
+
+// isDots reports whether an ASCII "..." ellipsis starts at i
+func isDots(text []rune, i int) bool {
+	return i+2 < len(text) && text[i] == '.' && text[i+1] == '.' && text[i+2] == '.'
+}
@@ -0,0 +1,67 @@
+package textproc
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSplitSentences(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{"terminators", "猫が好き。犬も好き！本当？", []string{"猫が好き。", "犬も好き！", "本当？"}},
+		{"run of terminators", "えっ！？そうなの。", []string{"えっ！？", "そうなの。"}},
+		{"ascii space inside a sentence", "iPhone 15を買った。", []string{"iPhone 15を買った。"}},
+		{"ascii space after a terminator", "行った。 次は何？", []string{"行った。", "次は何？"}},
+		{"ideographic space", "　今日は晴れ。", []string{"今日は晴れ。"}},
+		{"line breaks", "一行目\n二行目\r\n三行目", []string{"一行目", "二行目", "三行目"}},
+		{"quotation inside a sentence", "「来たよ。」と言った。", []string{"「来たよ。」と言った。"}},
+		{"nested quotation", "「彼は『もう無理。』と言った。」と聞いた。", []string{"「彼は『もう無理。』と言った。」と聞いた。"}},
+		{"quotation standing alone", "「おはよう。」「おはよう！」", []string{"「おはよう。」", "「おはよう！」"}},
+		{"quotation followed by a space", "「はい」 と答えた。", []string{"「はい」 と答えた。"}},
+		{"terminator before closing bracket", "（笑）。彼は来た。", []string{"（笑）。", "彼は来た。"}},
+		{"ellipsis mid-sentence", "それは…違うと思う。", []string{"それは…違うと思う。"}},
+		{"ellipsis before a space", "そうか… でも行く。", []string{"そうか… でも行く。"}},
+		{"ellipsis at a line break", "そうか……\nでも行く。", []string{"そうか……", "でも行く。"}},
+		{"ellipsis before a quotation", "まさか…「嘘だ」", []string{"まさか…", "「嘘だ」"}},
+		{"ellipsis then terminator", "待って…。どこ？", []string{"待って…。", "どこ？"}},
+		{"ascii dots", "えーと...\nはい。", []string{"えーと...", "はい。"}},
+		{"ellipsis at end of text", "そして…", []string{"そして…"}},
+		{"blank text", " \n　", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text := []rune(tt.text)
+			var got []string
+			for _, s := range SplitSentences(text) {
+				got = append(got, string(text[s.Start:s.End]))
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("SplitSentences(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSentenceAt(t *testing.T) {
+	text := []rune("猫。 犬。")
+	sentences := SplitSentences(text)
+	tests := []struct {
+		pos  int
+		want int
+	}{
+		{0, 0},
+		{1, 0},
+		{2, -1}, // The space between the sentences
+		{3, 1},
+		{4, 1},
+		{5, -1},
+	}
+	for _, tt := range tests {
+		if got := SentenceAt(sentences, tt.pos); got != tt.want {
+			t.Errorf("SentenceAt(%d) = %d, want %d", tt.pos, got, tt.want)
+		}
+	}
+}
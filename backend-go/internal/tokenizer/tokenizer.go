@@ -0,0 +1,113 @@
+package tokenizer
+
+import (
+	"fmt"
+	"strings"
+
+	"japanese-learning-app/internal/textproc"
+
+	"github.com/ikawaha/kagome-dict/ipa"
+	kagome "github.com/ikawaha/kagome/v2/tokenizer"
+)
+
+// Token is a single morpheme of book text
+type Token struct {
+	// Surface is the token as written in the original text
+	Surface string `json:"surface"`
+
+	// Start and End are rune offsets into the original (un-normalized) text
+	Start int `json:"start"`
+	End   int `json:"end"`
+
+	// Dictionary information; readings are in hiragana and empty for
+	// tokens the dictionary does not know
+	BaseForm     string `json:"base_form"`
+	Reading      string `json:"reading,omitempty"`
+	BaseReading  string `json:"base_reading,omitempty"`
+	PartOfSpeech string `json:"part_of_speech"`
+}
+
+// IsWord reports whether the token is a word worth tracking, as opposed to
+// punctuation, symbols, whitespace or numbers
+func (t Token) IsWord() bool {
+	if strings.TrimSpace(t.Surface) == "" {
+		return false
+	}
+	switch t.PartOfSpeech {
+	case "記号", "フィラー", "その他":
+		return false
+	}
+	for _, r := range t.Surface {
+		if !strings.ContainsRune("0123456789０１２３４５６７８９.,．，", r) {
+			return true
+		}
+	}
+	return false
+}
+
+// Tokenizer splits Japanese text into tokens. It is safe for concurrent use.
+type Tokenizer struct {
+	kagome *kagome.Tokenizer
+}
+
+// New creates a tokenizer backed by the IPA dictionary
+func New() (*Tokenizer, error) {
+	t, err := kagome.New(ipa.Dict(), kagome.OmitBosEos())
+	if err != nil {
+		return nil, fmt.Errorf("failed to load tokenizer dictionary: %w", err)
+	}
+	return &Tokenizer{kagome: t}, nil
+}
+
+// Tokenize normalizes text and splits it into tokens. Offsets and surfaces
+// refer to the original text, so they can be stored alongside annotations.
+func (t *Tokenizer) Tokenize(text string) []Token {
+	original := []rune(text)
+	norm := textproc.Normalize(text)
+
+	raw := t.kagome.Tokenize(norm.Text)
+	tokens := make([]Token, 0, len(raw))
+	for _, k := range raw {
+		start, end := norm.OriginalSpan(k.Start, k.End)
+		tok := Token{
+			Surface: string(original[start:end]),
+			Start:   start,
+			End:     end,
+		}
+		if pos := k.POS(); len(pos) > 0 {
+			tok.PartOfSpeech = pos[0]
+		}
+
+		tok.BaseForm = k.Surface
+		if base, ok := k.BaseForm(); ok && base != "*" {
+			tok.BaseForm = base
+		}
+		if reading, ok := k.Reading(); ok && reading != "*" {
+			tok.Reading = textproc.ToHiragana(reading)
+			tok.BaseReading = baseReading(k.Surface, tok.Reading, tok.BaseForm)
+		}
+		tokens = append(tokens, tok)
+	}
+	return tokens
+}
+
+// baseReading derives the reading of the dictionary form from the reading of
+// an inflected surface, e.g. 言っ/いっ with base form 言う gives いう. It relies
+// on inflection only changing the kana tail shared by surface and base form.
+func baseReading(surface, reading, base string) string {
+	if surface == base {
+		return reading
+	}
+	s, b := []rune(surface), []rune(base)
+	common := 0
+	for common < len(s) && common < len(b) && s[common] == b[common] {
+		common++
+	}
+
+	surfaceTail := textproc.ToHiragana(string(s[common:]))
+	if !strings.HasSuffix(reading, surfaceTail) || textproc.ContainsKanji(string(b[common:])) {
+		return ""
+	}
+	stem := strings.TrimSuffix(reading, surfaceTail)
+	return stem + textproc.ToHiragana(string(b[common:]))
+}
@@ -0,0 +1,183 @@
+package wordlist
+
+import (
+	"bufio"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"japanese-learning-app/internal/textproc"
+)
+
+// Entry is a word from a list, with an optional hiragana reading
+type Entry struct {
+	Word    string
+	Reading string
+}
+
+// builtin holds the JLPT lists that ship with the app
+//
+//go:embed data/jlpt_n*.txt
+var builtin embed.FS
+
+// Lists holds the JLPT vocabulary lists and the word frequency list used to
+// grade vocabulary. The JLPT lists are built in, and a file in the list
+// directory replaces the built-in list of its level. The frequency list is
+// optional; without it frequency ranks are unknown.
+//
+// Files in the list directory hold one word per line, optionally followed
+// by a tab and the reading, '#' starting a comment:
+//
+//	jlpt_n5.txt ... jlpt_n1.txt
+//	frequency.txt (most frequent first; the line number is the rank)
+type Lists struct {
+	jlpt      map[int][]Entry
+	jlptIndex map[string]int
+	frequency map[string]int
+}
+
+// Load reads the word lists from dir
+func Load(dir string) (*Lists, error) {
+	l := &Lists{
+		jlpt:      make(map[int][]Entry),
+		jlptIndex: make(map[string]int),
+		frequency: make(map[string]int),
+	}
+
+	// Load from the easiest level up so that a word listed at several levels
+	// keeps the easiest one
+	for level := 5; level >= 1; level-- {
+		name := fmt.Sprintf("jlpt_n%d.txt", level)
+		entries, err := readList(os.DirFS(dir), name, filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		if entries == nil {
+			entries, err = readList(builtin, "data/"+name, name)
+			if err != nil {
+				return nil, err
+			}
+		}
+		l.jlpt[level] = entries
+		for _, e := range entries {
+			for _, key := range keys(e.Word, e.Reading) {
+				if _, ok := l.jlptIndex[key]; !ok {
+					l.jlptIndex[key] = level
+				}
+			}
+		}
+	}
+
+	entries, err := readList(os.DirFS(dir), "frequency.txt", filepath.Join(dir, "frequency.txt"))
+	if err != nil {
+		return nil, err
+	}
+	for i, e := range entries {
+		for _, key := range keys(e.Word, e.Reading) {
+			if _, ok := l.frequency[key]; !ok {
+				l.frequency[key] = i + 1
+			}
+		}
+	}
+
+	return l, nil
+}
+
+// Empty returns lists without any data
+func Empty() *Lists {
+	return &Lists{
+		jlpt:      make(map[int][]Entry),
+		jlptIndex: make(map[string]int),
+		frequency: make(map[string]int),
+	}
+}
+
+// HasJLPT reports whether any JLPT list was loaded
+func (l *Lists) HasJLPT() bool {
+	return len(l.jlptIndex) > 0
+}
+
+// JLPTLevel returns the JLPT level (5 = N5 ... 1 = N1) of a word, or nil if
+// it is not on any list
+func (l *Lists) JLPTLevel(word, reading string) *int {
+	return lookup(l.jlptIndex, word, reading)
+}
+
+// JLPTEntries returns the words listed for a JLPT level
+func (l *Lists) JLPTEntries(level int) []Entry {
+	return l.jlpt[level]
+}
+
+// FrequencyRank returns the frequency rank of a word (1 = most frequent), or
+// nil if it is not on the list
+func (l *Lists) FrequencyRank(word, reading string) *int {
+	return lookup(l.frequency, word, reading)
+}
+
+func lookup(index map[string]int, word, reading string) *int {
+	if v, ok := index[word+"\t"+reading]; ok && reading != "" {
+		return &v
+	}
+	if v, ok := index[word]; ok {
+		return &v
+	}
+	return nil
+}
+
+// keys returns the index keys for an entry: the word with its reading, and
+// the bare word as a fallback
+func keys(word, reading string) []string {
+	if reading == "" {
+		return []string{word}
+	}
+	return []string{word + "\t" + reading, word}
+}
+
+// readList reads a word list file, path naming it in errors. A missing file
+// yields an empty list. A kana word without a reading is its own reading.
+func readList(fsys fs.FS, name, path string) ([]Entry, error) {
+	f, err := fsys.Open(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open word list %s: %w", path, err)
+	}
+	defer f.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		entry := Entry{Word: textproc.NormalizeString(strings.TrimSpace(fields[0]))}
+		if len(fields) > 1 {
+			entry.Reading = textproc.ToHiragana(strings.TrimSpace(fields[1]))
+		} else if isKana(entry.Word) {
+			entry.Reading = textproc.ToHiragana(entry.Word)
+		}
+		if entry.Word != "" {
+			entries = append(entries, entry)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read word list %s: %w", path, err)
+	}
+	return entries, nil
+}
+
+func isKana(s string) bool {
+	for _, r := range s {
+		if !textproc.IsKana(r) {
+			return false
+		}
+	}
+	return s != ""
+}
@@ -8,8 +8,13 @@ import (
 
 	"japanese-learning-app/internal/config"
 	"japanese-learning-app/internal/database"
+	"japanese-learning-app/internal/dictionary"
 	"japanese-learning-app/internal/handlers"
 	"japanese-learning-app/internal/middleware"
+	"japanese-learning-app/internal/optimizer"
+	"japanese-learning-app/internal/processing"
+	"japanese-learning-app/internal/tokenizer"
+	"japanese-learning-app/internal/wordlist"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -65,14 +70,68 @@ func main() {
 		"Accept",
 		"X-Requested-With",
 	}
-	r.Use(cors.New(corsConfig))
+	apiCORS := cors.New(corsConfig)
+
+	// The AnkiConnect endpoint is called by browser extensions such as Yomitan
+	// with an API key rather than cookies, so it has a policy of its own
+	ankiConnectCORS := cors.New(cors.Config{
+		AllowOriginFunc: func(origin string) bool {
+			return strings.HasPrefix(origin, "chrome-extension://") || strings.HasPrefix(origin, "moz-extension://") ||
+				strings.HasPrefix(origin, "safari-web-extension://")
+		},
+		AllowMethods: []string{"POST", "OPTIONS"},
+		AllowHeaders: []string{"Origin", "Content-Type"},
+	})
+	r.Use(func(c *gin.Context) {
+		if c.Request.URL.Path == "/api/ankiconnect" {
+			ankiConnectCORS(c)
+			return
+		}
+		apiCORS(c)
+	})
 
 	// Serve static files
 	r.Static("/static", "../frontend/static")
 	r.Static("/uploads", "../data/uploads")
 
+	// Load the Japanese tokenizer (dictionary is embedded in the binary)
+	tok, err := tokenizer.New()
+	if err != nil {
+		log.Fatalf("Failed to initialize tokenizer: %v", err)
+	}
+
+	// Load JLPT and frequency lists used to grade vocabulary
+	lists, err := wordlist.Load(cfg.WordListDir)
+	if err != nil {
+		log.Fatalf("Failed to load word lists: %v", err)
+	}
+
+	// Dictionary lookups fall back to Jisho when the local dictionaries have no match
+	var jisho *dictionary.JishoClient
+	if cfg.JishoAPIURL != "" {
+		jisho = dictionary.NewJishoClient(cfg.JishoAPIURL, dictionary.NewDBCache(db), dictionary.JishoOptions{})
+	}
+
+	// Refit FSRS users' scheduling weights to their reviews every week
+	opt := optimizer.New(db)
+	if n, err := opt.ResetInterrupted(); err != nil {
+		log.Printf("Failed to reset interrupted FSRS optimizations: %v", err)
+	} else if n > 0 {
+		log.Printf("Marked %d interrupted FSRS optimizations as failed", n)
+	}
+	go opt.RunWeekly()
+
+	// Books still processing were interrupted by the last shutdown
+	processor := processing.New(db, tok, lists)
+	if n, err := processor.ResetInterrupted(); err != nil {
+		log.Printf("Failed to reset interrupted book processing: %v", err)
+	} else if n > 0 {
+		log.Printf("Marked %d interrupted book analyses as failed", n)
+	}
+
 	// Initialize handlers
-	h := handlers.New(db)
+	h := handlers.New(db, tok, processor, dictionary.NewService(db, jisho), lists, opt)
+	h.SetMediaDir(cfg.MediaDir)
 
 	// Database middleware - make database available to all routes
 	r.Use(func(c *gin.Context) {
@@ -98,6 +157,9 @@ func main() {
 			auth.POST("/login", h.Login)
 		}
 
+		// AnkiConnect clients authenticate with the user's API key
+		api.POST("/ankiconnect", h.AnkiConnect)
+
 		// Protected routes
 		protected := api.Group("/")
 		protected.Use(middleware.AuthRequired())
@@ -105,6 +167,10 @@ func main() {
 			// User routes
 			protected.GET("/auth/me", h.GetCurrentUser)
 			protected.POST("/auth/logout", h.Logout)
+			protected.PATCH("/auth/me", h.UpdateCurrentUser)
+			protected.PATCH("/auth/me/preferences", h.UpdatePreferences)
+			protected.POST("/auth/me/api-key", h.CreateAPIKey)
+			protected.DELETE("/auth/me/api-key", h.DeleteAPIKey)
 
 			// Book routes
 			books := protected.Group("/books")
@@ -113,6 +179,11 @@ func main() {
 				books.POST("/upload", h.UploadBook)
 				books.GET("/:id", h.GetBook)
 				books.DELETE("/:id", h.DeleteBook)
+				books.POST("/:id/analyze", h.AnalyzeBook)
+				books.GET("/:id/chapters", h.GetBookChapters)
+				books.GET("/:id/sentences", h.GetBookSentences)
+				books.GET("/:id/vocab", h.GetBookVocab)
+				books.GET("/:id/chapters/:n/furigana", h.GetChapterFurigana)
 			}
 
 			// Word routes
@@ -120,13 +191,38 @@ func main() {
 			{
 				words.GET("/lookup/:word", h.LookupWord)
 				words.POST("/mark-known", h.MarkWordAsKnown)
+				words.POST("/bulk/knowledge", h.SetWordsKnowledge)
+				words.POST("/bulk/ignore", h.IgnoreWords)
+				words.POST("/import", h.ImportKnownWords)
 			}
 
 			// SRS routes
 			srs := protected.Group("/srs")
 			{
 				srs.GET("/due-cards", h.GetDueCards)
+				srs.GET("/forecast", h.GetForecast)
 				srs.POST("/review", h.ReviewCard)
+				srs.POST("/undo", h.UndoReview)
+				srs.POST("/import/anki", h.ImportAnki)
+				srs.GET("/export/anki", h.ExportAnki)
+				srs.POST("/cards", h.CreateCard)
+				srs.POST("/cards/bulk", h.BulkCardAction)
+				srs.POST("/cards/:id/:action", h.CardAction)
+				srs.GET("/decks", h.GetDecks)
+				srs.POST("/decks", h.CreateDeck)
+				srs.PATCH("/decks/:id", h.UpdateDeck)
+				srs.DELETE("/decks/:id", h.DeleteDeck)
+				srs.POST("/decks/:id/rebuild", h.RebuildDeck)
+				srs.POST("/decks/:id/empty", h.EmptyDeck)
+				srs.POST("/optimize", h.OptimizeWeights)
+				srs.GET("/optimize", h.GetOptimizations)
+			}
+
+			// Sentence mining routes
+			mining := protected.Group("/mining")
+			{
+				mining.GET("/i-plus-one", h.GetIPlusOneSentences)
+				mining.POST("/sentence", h.MineSentence)
 			}
 
 			// Reading session routes